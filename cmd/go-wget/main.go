@@ -0,0 +1,319 @@
+// go-wget: a command line HTTP client on top of github.com/rosbit/go-wget
+//
+// usage: go-wget [flags] URL
+//
+// exit codes:
+//   0 success
+//   1 generic error
+//   2 invalid command line
+//   3 file I/O error
+//   4 network failure: DNS, connection refused etc.
+//   5 TLS error
+//   6 timeout
+//   8 server issued an error response (status >= 400)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rosbit/go-wget"
+)
+
+const (
+	exit_ok = 0
+	exit_error = 1
+	exit_usage = 2
+	exit_io = 3
+	exit_network = 4
+	exit_tls = 5
+	exit_timeout = 6
+	exit_server_error = 8
+)
+
+// returned by parseArgs if the error is reported by the flag package already
+var errFlagParse = errors.New("bad flags")
+
+// a flag which can be given more than once
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *multiFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+type cmdArgs struct {
+	method   string
+	headers  multiFlag
+	data     multiFlag
+	json     string
+	output   string
+	resume   bool
+	bases    multiFlag
+	timeout  int
+	verbose  bool
+	url      string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(argv []string) int {
+	args, err := parseArgs(argv)
+	if err == flag.ErrHelp {
+		return exit_ok
+	}
+	if err == errFlagParse {
+		return exit_usage
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-wget: %v\n", err)
+		return exit_usage
+	}
+	if args.verbose {
+		wget.Use(dumper(os.Stderr))
+	}
+
+	if args.resume {
+		err = download(args)
+	} else {
+		var status int
+		status, err = request(args)
+		if err == nil && status >= http.StatusBadRequest {
+			fmt.Fprintf(os.Stderr, "go-wget: %d %s\n", status, http.StatusText(status))
+			return exit_server_error
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-wget: %v\n", err)
+		return exitCode(err)
+	}
+	return exit_ok
+}
+
+func parseArgs(argv []string) (*cmdArgs, error) {
+	args := &cmdArgs{}
+	fs := flag.NewFlagSet("go-wget", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: go-wget [flags] URL\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&args.method, "X", "", "request method, GET by default, POST if -d or --json is given")
+	fs.Var(&args.headers, "H", "request header \"Name: value\", can be given more than once")
+	fs.Var(&args.data, "d", "form param \"name=value\", can be given more than once")
+	fs.StringVar(&args.json, "json", "", "JSON request body, or @file to read it from file")
+	fs.StringVar(&args.output, "o", "", "write the response body to file instead of stdout")
+	fs.BoolVar(&args.resume, "c", false, "continue a partially downloaded file with GET, -o is required")
+	fs.Var(&args.bases, "base", "base URL \"http://host:port[,weight]\", can be given more than once. URL is relative to them")
+	fs.IntVar(&args.timeout, "timeout", 0, "timeout in seconds of the whole request")
+	fs.BoolVar(&args.verbose, "v", false, "dump the request and response headers to stderr")
+	if err := fs.Parse(argv); err != nil {
+		if err == flag.ErrHelp {
+			return nil, err
+		}
+		return nil, errFlagParse
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, fmt.Errorf("one URL expected")
+	}
+	args.url = fs.Arg(0)
+	if len(args.data) > 0 && len(args.json) > 0 {
+		return nil, fmt.Errorf("-d and --json can not be used together")
+	}
+	if args.resume && len(args.output) == 0 {
+		return nil, fmt.Errorf("-c requires -o")
+	}
+	if args.resume {
+		// Download always sends GET without body
+		switch {
+		case len(args.bases) > 0:
+			return nil, fmt.Errorf("-c can not be used with --base")
+		case len(args.json) > 0:
+			return nil, fmt.Errorf("-c can not be used with --json")
+		case len(args.data) > 0:
+			return nil, fmt.Errorf("-c can not be used with -d")
+		case len(args.method) > 0 && !strings.EqualFold(args.method, http.MethodGet):
+			return nil, fmt.Errorf("-c can not be used with -X %s", args.method)
+		}
+	}
+	if len(args.method) == 0 {
+		if len(args.data) > 0 || len(args.json) > 0 {
+			args.method = http.MethodPost
+		} else {
+			args.method = http.MethodGet
+		}
+	}
+	return args, nil
+}
+
+func request(args *cmdArgs) (int, error) {
+	header, err := parseHeaders(args.headers)
+	if err != nil {
+		return 0, err
+	}
+	options := wget.Options{Timeout: args.timeout, DontReadRespBody: true}
+	if len(args.bases) > 0 {
+		if options.MultiBase, err = parseBases(args.bases); err != nil {
+			return 0, err
+		}
+	}
+
+	var status int
+	var resp *http.Response
+	if len(args.json) > 0 {
+		var body []byte
+		if body, err = readArg(args.json); err != nil {
+			return 0, err
+		}
+		status, _, resp, err = wget.PostJsonHeader(args.url, args.method, body, header, options)
+	} else {
+		var params interface{}
+		if len(args.data) > 0 {
+			if params, err = parseData(args.data); err != nil {
+				return 0, err
+			}
+		}
+		status, _, resp, err = wget.WgetHeader(args.url, args.method, params, header, options)
+	}
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if len(args.output) > 0 {
+		f, err := os.Create(args.output)
+		if err != nil {
+			return status, err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, resp.Body)
+	return status, err
+}
+
+func download(args *cmdArgs) error {
+	header, err := parseHeaders(args.headers)
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(header))
+	for k := range header {
+		headers[k] = header.Get(k)
+	}
+	return wget.Download(args.url, args.output, &wget.DownloadArgs{
+		Args: wget.Args{Headers: headers, Timeout: args.timeout},
+	})
+}
+
+func parseHeaders(headers []string) (http.Header, error) {
+	header := make(http.Header, len(headers))
+	for _, h := range headers {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("bad header %q, \"Name: value\" expected", h)
+		}
+		header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+	return header, nil
+}
+
+func parseData(data []string) (url.Values, error) {
+	params := url.Values{}
+	for _, d := range data {
+		i := strings.IndexByte(d, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("bad form param %q, \"name=value\" expected", d)
+		}
+		params.Add(d[:i], d[i+1:])
+	}
+	return params, nil
+}
+
+// "http://host:port" or "http://host:port,weight"
+func parseBases(bases []string) (*wget.BaseUrl, error) {
+	baseUrls := make([]string, len(bases))
+	var weights []uint
+	for i, base := range bases {
+		baseUrls[i] = base
+		if j := strings.LastIndexByte(base, ','); j > 0 {
+			weight, err := strconv.ParseUint(base[j+1:], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad weight of base URL %q", base)
+			}
+			if weights == nil {
+				weights = make([]uint, len(bases))
+			}
+			baseUrls[i], weights[i] = base[:j], uint(weight)
+		}
+	}
+	return wget.NewWeightedBaseUrl(baseUrls, weights)
+}
+
+// content of arg, or of the file if arg is "@file"
+func readArg(arg string) ([]byte, error) {
+	if strings.HasPrefix(arg, "@") {
+		return ioutil.ReadFile(arg[1:])
+	}
+	return []byte(arg), nil
+}
+
+func exitCode(err error) int {
+	var httpErr *wget.HTTPError
+	var pathErr *os.PathError
+	switch {
+	case errors.As(err, &httpErr):
+		return exit_server_error
+	case errors.As(err, &pathErr):
+		return exit_io
+	case wget.IsTLSError(err):
+		return exit_tls
+	case wget.IsTimeout(err):
+		return exit_timeout
+	case wget.IsDNSError(err), wget.IsConnRefused(err), wget.IsRetryable(err):
+		return exit_network
+	default:
+		return exit_error
+	}
+}
+
+// middleware dumping the request and response headers
+func dumper(w io.Writer) wget.Middleware {
+	return func(next wget.RoundTripFunc) wget.RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if b, err := httputil.DumpRequest(req, false); err == nil {
+				writePrefixed(w, "> ", b)
+			}
+			resp, err := next(req)
+			if resp != nil {
+				if b, e := httputil.DumpResponse(resp, false); e == nil {
+					writePrefixed(w, "< ", b)
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+func writePrefixed(w io.Writer, prefix string, b []byte) {
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, strings.TrimRight(line, "\r"))
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/rosbit/go-wget"
+)
+
+func Test_ParseArgs(t *testing.T) {
+	cases := []struct{
+		argv   []string
+		method string
+		err    bool
+	}{
+		{[]string{"http://a"}, http.MethodGet, false},
+		{[]string{"-d", "a=b", "http://a"}, http.MethodPost, false},
+		{[]string{"--json", "{}", "http://a"}, http.MethodPost, false},
+		{[]string{"-X", "PUT", "-d", "a=b", "http://a"}, "PUT", false},
+		{[]string{"-c", "-o", "a.bin", "http://a"}, http.MethodGet, false},
+		{[]string{"-c", "-o", "a.bin", "-X", "get", "http://a"}, "get", false},
+		{[]string{}, "", true},
+		{[]string{"http://a", "http://b"}, "", true},
+		{[]string{"-d", "a=b", "--json", "{}", "http://a"}, "", true},
+		{[]string{"-c", "http://a"}, "", true},
+		{[]string{"-c", "-o", "a.bin", "--base", "http://b", "/a"}, "", true},
+		{[]string{"-c", "-o", "a.bin", "--json", "{}", "http://a"}, "", true},
+		{[]string{"-c", "-o", "a.bin", "-d", "a=b", "http://a"}, "", true},
+		{[]string{"-c", "-o", "a.bin", "-X", "POST", "http://a"}, "", true},
+		{[]string{"--no-such-flag", "http://a"}, "", true},
+	}
+	for _, c := range cases {
+		args, err := parseArgs(c.argv)
+		if c.err {
+			if err == nil {
+				t.Fatalf("error expected for %v\n", c.argv)
+			}
+			continue
+		}
+		if err != nil || args.method != c.method || args.url != c.argv[len(c.argv)-1] {
+			t.Fatalf("unexpected result for %v: %#v, %v\n", c.argv, args, err)
+		}
+	}
+}
+
+func Test_Run(t *testing.T) {
+	cases := []struct{
+		argv []string
+		code int
+	}{
+		{[]string{"-h"}, exit_ok},
+		{[]string{"--no-such-flag"}, exit_usage},
+		{[]string{}, exit_usage},
+		{[]string{"-c", "-o", "a.bin", "-d", "a=b", "http://a"}, exit_usage},
+	}
+	for _, c := range cases {
+		if code := run(c.argv); code != c.code {
+			t.Fatalf("exit code %d expected for %v, got %d\n", c.code, c.argv, code)
+		}
+	}
+}
+
+func Test_ParseHeaders(t *testing.T) {
+	header, err := parseHeaders([]string{"Accept: text/html", "X-A:1", "x-a: 2 "})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	expected := http.Header{"Accept": {"text/html"}, "X-A": {"1", "2"}}
+	if !reflect.DeepEqual(header, expected) {
+		t.Fatalf("unexpected header: %v\n", header)
+	}
+	for _, h := range []string{"Accept", ": value"} {
+		if _, err = parseHeaders([]string{h}); err == nil {
+			t.Fatalf("error expected for %q\n", h)
+		}
+	}
+}
+
+func Test_ParseData(t *testing.T) {
+	params, err := parseData([]string{"a=1", "a=2", "b=", "c=x=y"})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if p := params.Encode(); p != "a=1&a=2&b=&c=x%3Dy" {
+		t.Fatalf("unexpected params: %s\n", p)
+	}
+	for _, d := range []string{"a", "=1"} {
+		if _, err = parseData([]string{d}); err == nil {
+			t.Fatalf("error expected for %q\n", d)
+		}
+	}
+}
+
+func Test_ParseBases(t *testing.T) {
+	cases := []struct{
+		bases []string
+		err   bool
+	}{
+		{[]string{"http://a"}, false},
+		{[]string{"http://a", "http://b"}, false},
+		{[]string{"http://a,3", "http://b,1"}, false},
+		{[]string{"http://a,x"}, true},
+		{[]string{"http://a,-1"}, true},
+	}
+	for _, c := range cases {
+		b, err := parseBases(c.bases)
+		if c.err {
+			if err == nil {
+				t.Fatalf("error expected for %v\n", c.bases)
+			}
+			continue
+		}
+		if err != nil || b == nil {
+			t.Fatalf("unexpected result for %v: %v\n", c.bases, err)
+		}
+	}
+}
+
+func Test_ExitCode(t *testing.T) {
+	cases := []struct{
+		err  error
+		code int
+	}{
+		{&wget.HTTPError{Status: http.StatusNotFound}, exit_server_error},
+		{fmt.Errorf("wrapped: %w", &wget.HTTPError{Status: http.StatusBadGateway}), exit_server_error},
+		{&os.PathError{Op: "open", Path: "a", Err: syscall.ENOENT}, exit_io},
+		{x509.UnknownAuthorityError{}, exit_tls},
+		{context.DeadlineExceeded, exit_timeout},
+		{&net.DNSError{Err: "no such host", Name: "a.invalid", IsNotFound: true}, exit_network},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, exit_network},
+		{errors.New("unknown"), exit_error},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.code {
+			t.Fatalf("exit code %d expected for %v, got %d\n", c.code, c.err, code)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package wget
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// in is encoded by codec as request body, JSON is used if codec is nil. no body is sent if in is nil.
+// response body is decoded into out by the codec registered for the response Content-Type,
+// or by codec if there's no such one.
+func Call(url string, method string, codec Codec, in interface{}, out interface{}, options ...Options) (int, error) {
+	return CallContext(context.Background(), url, method, codec, in, out, options...)
+}
+
+func CallContext(ctx context.Context, url string, method string, codec Codec, in interface{}, out interface{}, options ...Options) (int, error) {
+	status, _, err := callContext(ctx, url, method, codec, in, out, false, options...)
+	return status, err
+}
+
+// body of resp is consumed and closed. out of type *[]byte or *string gets the raw body if rawOut is true.
+func callContext(ctx context.Context, url string, method string, codec Codec, in interface{}, out interface{}, rawOut bool, options ...Options) (int, *http.Response, error) {
+	if codec == nil {
+		codec = JsonCodec
+	}
+
+	var op *Options
+	if len(options) > 0 {
+		op = &options[0]
+		op.DontReadRespBody = true
+	} else {
+		op = &Options{DontReadRespBody:true}
+	}
+
+	header := http.Header{"Accept": {mediaType(codec.ContentType())}}
+	var status int
+	var resp *http.Response
+	var err error
+	if in == nil {
+		status, _, resp, err = WgetHeaderContext(ctx, url, method, nil, header, *op)
+	} else {
+		status, _, resp, err = callCodecContext(ctx, url, method, in, header, codec, *op)
+	}
+	if err != nil {
+		return status, resp, err
+	}
+	if err = checkStatus(resp, codec, op); err != nil || resp.Body == nil {
+		return status, resp, err
+	}
+
+	if !rawOut {
+		return status, resp, decodeRespByType(resp, codec, out, op.DebugWriter)
+	}
+	switch raw := out.(type) {
+	case *[]byte:
+		*raw, err = readResp(resp, op.DebugWriter)
+		return status, resp, err
+	case *string:
+		var b []byte
+		b, err = readResp(resp, op.DebugWriter)
+		*raw = string(b)
+		return status, resp, err
+	}
+	return status, resp, decodeRespByType(resp, codec, out, op.DebugWriter)
+}
+
+// decode with the codec of the response Content-Type, or codec if there's no such one
+func decodeRespByType(resp *http.Response, codec Codec, out interface{}, debugWriter io.Writer) error {
+	if c := GetCodec(resp.Header.Get("Content-Type")); c != nil {
+		codec = c
+	}
+	return decodeResp(resp, codec, out, debugWriter)
+}
+
+func readResp(resp *http.Response, debugWriter io.Writer) ([]byte, error) {
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if debugWriter != nil {
+		fmt.Fprintf(debugWriter, "body: %s\n", b)
+	}
+	return b, err
+}
+
+func callCodecContext(ctx context.Context, url, method string, params interface{}, header http.Header, codec Codec, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	if !isHttpUrl(url) && len(options) > 0 && options[0].MultiBase != nil {
+		return options[0].MultiBase.codecCall(ctx, url, method, params, header, codec, options...)
+	}
+	return newRequest(url, 0, options...).runCodec(ctx, url, method, params, header, codec)
+}
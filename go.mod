@@ -1,5 +1,5 @@
 module github.com/rosbit/go-wget
 
-go 1.12
+go 1.18
 
-require github.com/mroth/weightedrand v0.4.1 // indirect
+require github.com/mroth/weightedrand v0.4.1
@@ -1,21 +1,30 @@
 package wget
 
 import (
-	"encoding/json"
+	"context"
 	"io"
+	"net/http"
 )
 
 type FnCallJ func(url string, method string, params interface{}, headers map[string]string, res interface{}, options ...Options) (status int, err error)
 
 func HttpCallJ(url string, method string, postData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
-	return callWgetJ(url, method, postData, headers, Wget, res, options...)
+	return callWgetJ(context.Background(), url, method, postData, headers, WgetContext, JsonCodec, res, options...)
 }
 
 func JsonCallJ(url string, method string, jsonData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
-	return callWgetJ(url, method, jsonData, headers, PostJson, res, options...)
+	return callWgetJ(context.Background(), url, method, jsonData, headers, PostJsonContext, JsonCodec, res, options...)
 }
 
-func callWgetJ(url string, method string, postData interface{}, headers map[string]string, fnCall HttpFunc, res interface{}, options ...Options) (int, error) {
+func HttpCallJContext(ctx context.Context, url string, method string, postData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(ctx, url, method, postData, headers, WgetContext, JsonCodec, res, options...)
+}
+
+func JsonCallJContext(ctx context.Context, url string, method string, jsonData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(ctx, url, method, jsonData, headers, PostJsonContext, JsonCodec, res, options...)
+}
+
+func callWgetJ(ctx context.Context, url string, method string, postData interface{}, headers map[string]string, fnCall HttpFuncContext, codec Codec, res interface{}, options ...Options) (int, error) {
 	var op *Options
 	if len(options) > 0 {
 		op = &options[0]
@@ -24,19 +33,27 @@ func callWgetJ(url string, method string, postData interface{}, headers map[stri
 		op = &Options{DontReadRespBody:true}
 	}
 
-	status, _, resp, err := fnCall(url, method, postData, headers, *op)
-	if err != nil || resp.Body == nil {
+	status, _, resp, err := fnCall(ctx, url, method, postData, headers, *op)
+	if err != nil {
 		return status, err
 	}
+	if err = checkStatus(resp, codec, op); err != nil || resp.Body == nil {
+		return status, err
+	}
+	return status, decodeResp(resp, codec, res, op.DebugWriter)
+}
+
+// decode response body into res with codec, and close the body.
+func decodeResp(resp *http.Response, codec Codec, res interface{}, debugWriter io.Writer) error {
 	defer resp.Body.Close()
 
-	if op.DebugWriter == nil {
-		return status, json.NewDecoder(resp.Body).Decode(res)
+	if debugWriter == nil {
+		return codec.Decode(resp.Body, res)
 	}
 
-	w := op.DebugWriter
+	w := debugWriter
 	io.WriteString(w, "body: ")
 	r := io.TeeReader(resp.Body, w)
 	defer io.WriteString(w, "\n")
-	return status, json.NewDecoder(r).Decode(res)
+	return codec.Decode(r, res)
 }
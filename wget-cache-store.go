@@ -0,0 +1,127 @@
+package wget
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	default_memory_cache_bytes = 64 << 20
+)
+
+// an in-memory LRU Cache holding at most maxBytes of entries
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List // front is the most recently used
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// default_memory_cache_bytes is used if maxBytes is not given
+func NewMemoryCache(maxBytes ...int64) *MemoryCache {
+	c := &MemoryCache{maxBytes: default_memory_cache_bytes, ll: list.New(), items: make(map[string]*list.Element)}
+	if len(maxBytes) > 0 && maxBytes[0] > 0 {
+		c.maxBytes = maxBytes[0]
+	}
+	return c
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*memoryCacheItem).value, true
+	}
+	return nil, false
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	if int64(len(value)) > c.maxBytes {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	c.size += int64(len(value))
+	for c.size > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *MemoryCache) removeElement(e *list.Element) {
+	item := c.ll.Remove(e).(*memoryCacheItem)
+	delete(c.items, item.key)
+	c.size -= int64(len(item.value))
+}
+
+// a Cache saving every entry as a file under dir, named by the SHA-256 of its key.
+// there's no size limit, remove the files to clean it.
+type DiskCache struct {
+	dir string
+}
+
+// dir is created if it doesn't exist
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// the entry is written to a temporary file then renamed, so readers never get a partial one
+func (c *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,419 @@
+package wget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// storage of cached responses, set it with Options.Cache or Args.Cache.
+// NewMemoryCache() and NewDiskCache() are provided.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// values of the cache status of a response, cf. GetCacheStatus()
+const (
+	CacheHit         = "hit"         // served from the cache without sending the request
+	CacheMiss        = "miss"        // fetched from the server
+	CacheRevalidated = "revalidated" // the stale entry is validated by the server with 304, and served from the cache
+)
+
+const (
+	cache_status_header = "Cache-Status"
+	cache_name = "go-wget"
+	max_cache_entry_bytes = 8 << 20 // larger responses are not stored
+)
+
+// cache status of a response got with Options.Cache, one of CacheHit, CacheMiss and CacheRevalidated.
+// it is "" if the response is not got through a cache. the status is also sent as header
+// Cache-Status (RFC 9211), e.g. "go-wget; hit".
+func GetCacheStatus(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	v := resp.Header.Get(cache_status_header)
+	switch {
+	case !strings.HasPrefix(v, cache_name + ";"):
+		return ""
+	case strings.Contains(v, "; hit"):
+		return CacheHit
+	case strings.Contains(v, "fwd-status=304"):
+		return CacheRevalidated
+	default:
+		return CacheMiss
+	}
+}
+
+// a stored response
+type cacheEntry struct {
+	StatusCode   int                 `json:"status"`
+	Header       http.Header         `json:"header"`
+	Body         []byte              `json:"body"`
+	RequestTime  time.Time           `json:"request_time"`
+	ResponseTime time.Time           `json:"response_time"`
+	Vary         map[string][]string `json:"vary,omitempty"` // request headers named by Vary
+}
+
+// limits applied while a response body is buffered for storing
+type cacheLimits struct {
+	maxBodyBytes int64         // Options.MaxBodyBytes, larger responses are not stored
+	idleRead     time.Duration // Timeouts.IdleRead
+}
+
+// middleware serving GET/HEAD requests from cache as a private cache of RFC 9111.
+// stale entries are revalidated with If-None-Match/If-Modified-Since. responses to requests with
+// credentials (Authorization, Cookie or cookies of jar) are stored per credentials.
+func cacheMiddleware(cache Cache, jar http.CookieJar, limits cacheLimits) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				resp, err := next(req)
+				if err == nil && !safeMethod(req.Method) && resp.StatusCode < http.StatusBadRequest {
+					// unsafe methods invalidate the stored responses
+					cache.Delete(cacheKey(http.MethodGet, req, jar))
+					cache.Delete(cacheKey(http.MethodHead, req, jar))
+				}
+				return resp, err
+			}
+			if len(req.Header.Get("Range")) > 0 || isConditional(req.Header) {
+				return next(req)
+			}
+
+			reqCC := parseCacheControl(req.Header)
+			if _, ok := reqCC["no-store"]; ok {
+				return next(req)
+			}
+
+			key := cacheKey(req.Method, req, jar)
+			entry := loadCacheEntry(cache, key, req)
+			if entry == nil {
+				return fetchAndStore(cache, key, req, next, limits, "fwd=miss")
+			}
+			if entry.fresh(reqCC, time.Now()) {
+				return entry.response(req, "hit"), nil
+			}
+
+			etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+			if len(etag) == 0 && len(lastModified) == 0 {
+				return fetchAndStore(cache, key, req, next, limits, "fwd=stale")
+			}
+			condReq := req.Clone(req.Context())
+			if len(etag) > 0 {
+				condReq.Header.Set("If-None-Match", etag)
+			}
+			if len(lastModified) > 0 {
+				condReq.Header.Set("If-Modified-Since", lastModified)
+			}
+			requestTime := time.Now()
+			resp, err := next(condReq)
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode != http.StatusNotModified {
+				return storeResp(cache, key, req, resp, requestTime, limits, "fwd=stale")
+			}
+			discardResp(resp)
+
+			// headers of 304 update the stored ones
+			for k, vs := range resp.Header {
+				if k != "Content-Length" {
+					entry.Header[k] = vs
+				}
+			}
+			entry.RequestTime, entry.ResponseTime = requestTime, time.Now()
+			saveCacheEntry(cache, key, entry)
+			return entry.response(req, "fwd=stale; fwd-status=304"), nil
+		}
+	}
+}
+
+func fetchAndStore(cache Cache, key string, req *http.Request, next RoundTripFunc, limits cacheLimits, status string) (*http.Response, error) {
+	requestTime := time.Now()
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+	return storeResp(cache, key, req, resp, requestTime, limits, status)
+}
+
+// store resp if it is cacheable. the body of a response larger than max_cache_entry_bytes or
+// limits.maxBodyBytes is passed through without being stored, and is checked by the caller.
+func storeResp(cache Cache, key string, req *http.Request, resp *http.Response, requestTime time.Time, limits cacheLimits, status string) (*http.Response, error) {
+	resp.Header.Set(cache_status_header, fmt.Sprintf("%s; %s", cache_name, status))
+	if !cacheable(req, resp) {
+		return resp, nil
+	}
+
+	maxBytes := int64(max_cache_entry_bytes)
+	if limits.maxBodyBytes > 0 && limits.maxBodyBytes < maxBytes {
+		maxBytes = limits.maxBodyBytes
+	}
+	if resp.ContentLength > maxBytes {
+		return resp, nil
+	}
+	var r io.Reader = resp.Body
+	if limits.idleRead > 0 {
+		// the body is closed if it is idle too long, so the blocked read fails
+		rawBody := resp.Body
+		idleBody := newIdleTimeoutBody(rawBody, limits.idleRead, func() { rawBody.Close() })
+		defer idleBody.timer.Stop()
+		r = idleBody
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	header.Del(cache_status_header)
+	if req.Method == http.MethodHead && resp.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	entry := &cacheEntry{
+		StatusCode: resp.StatusCode,
+		Header: header,
+		Body: body,
+		RequestTime: requestTime,
+		ResponseTime: time.Now(),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if entry.Vary == nil {
+			entry.Vary = make(map[string][]string)
+		}
+		entry.Vary[name] = req.Header.Values(name)
+	}
+	saveCacheEntry(cache, key, entry)
+	return resp, nil
+}
+
+// the digest of the credentials is appended, so responses are not shared by different users, RFC 9111 3.5
+func cacheKey(method string, req *http.Request, jar http.CookieJar) string {
+	key := method + " " + req.URL.String()
+	credentials := req.Header.Values("Authorization")
+	credentials = append(credentials, req.Header.Values("Cookie")...)
+	if jar != nil {
+		for _, c := range jar.Cookies(req.URL) {
+			credentials = append(credentials, c.String())
+		}
+	}
+	if len(credentials) == 0 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(strings.Join(credentials, "\n")))
+	return key + " " + hex.EncodeToString(sum[:])
+}
+
+func isConditional(header http.Header) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		if len(header.Get(name)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// the entry is nil if it is not found, broken, or the request headers named by Vary are changed
+func loadCacheEntry(cache Cache, key string, req *http.Request) *cacheEntry {
+	b, ok := cache.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		cache.Delete(key)
+		return nil
+	}
+	for _, name := range varyHeaders(entry.Header) {
+		if name == "*" || strings.Join(req.Header.Values(name), ",") != strings.Join(entry.Vary[name], ",") {
+			return nil
+		}
+	}
+	return &entry
+}
+
+func saveCacheEntry(cache Cache, key string, entry *cacheEntry) {
+	if b, err := json.Marshal(entry); err == nil {
+		cache.Set(key, b)
+	}
+}
+
+func (entry *cacheEntry) response(req *http.Request, status string) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(entry.currentAge(time.Now())/time.Second), 10))
+	header.Set(cache_status_header, fmt.Sprintf("%s; %s", cache_name, status))
+	body, contentLength := entry.Body, int64(len(entry.Body))
+	if req.Method == http.MethodHead {
+		// the body of HEAD is not stored, but the length of the one of GET is kept
+		body, contentLength = nil, -1
+		if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			contentLength = n
+		}
+	}
+	return &http.Response{
+		Status: fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode: entry.StatusCode,
+		Proto: "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: header,
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: contentLength,
+		Request: req,
+	}
+}
+
+// whether the entry can be served without revalidation
+func (entry *cacheEntry) fresh(reqCC map[string]string, now time.Time) bool {
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	respCC := parseCacheControl(entry.Header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	lifetime := entry.freshnessLifetime(respCC)
+	if v, ok := reqCC["max-age"]; ok {
+		if maxAge, err := strconv.ParseInt(v, 10, 64); err == nil && time.Duration(maxAge)*time.Second < lifetime {
+			lifetime = time.Duration(maxAge) * time.Second
+		}
+	}
+	return lifetime > entry.currentAge(now)
+}
+
+// by max-age, Expires or heuristic with Last-Modified
+func (entry *cacheEntry) freshnessLifetime(respCC map[string]string) time.Duration {
+	if v, ok := respCC["max-age"]; ok {
+		if maxAge, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(maxAge) * time.Second
+		}
+		return 0
+	}
+	date := entry.date()
+	if v := entry.Header.Get("Expires"); len(v) > 0 {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if heuristicCacheable(entry.StatusCode) {
+		if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+			return date.Sub(lastModified) / 10
+		}
+	}
+	return 0
+}
+
+func (entry *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		return date
+	}
+	return entry.ResponseTime
+}
+
+// current_age of RFC 9111 4.2.3
+func (entry *cacheEntry) currentAge(now time.Time) time.Duration {
+	apparentAge := entry.ResponseTime.Sub(entry.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	var ageValue time.Duration
+	if age, err := strconv.ParseInt(entry.Header.Get("Age"), 10, 64); err == nil {
+		ageValue = time.Duration(age) * time.Second
+	}
+	correctedAge := ageValue + entry.ResponseTime.Sub(entry.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(entry.ResponseTime)
+}
+
+func cacheable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if _, ok := respCC["max-age"]; ok {
+		return true
+	}
+	if len(resp.Header.Get("Expires")) > 0 {
+		return true
+	}
+	if !heuristicCacheable(resp.StatusCode) {
+		return false
+	}
+	// to be revalidated
+	return len(resp.Header.Get("ETag")) > 0 || len(resp.Header.Get("Last-Modified")) > 0
+}
+
+// status codes heuristically cacheable, RFC 9110 15.1
+func heuristicCacheable(status int) bool {
+	switch status {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// directives of Cache-Control (and Pragma: no-cache) with lower-cased names
+func parseCacheControl(header http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if len(directive) == 0 {
+				continue
+			}
+			name, value := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, value = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	if len(header.Values("Cache-Control")) == 0 && strings.Contains(strings.ToLower(header.Get("Pragma")), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
@@ -0,0 +1,265 @@
+package wget
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// encoder of request body and decoder of response body for a content type
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Decode(r io.Reader, v interface{}) error
+}
+
+// a Codec made of marshal/unmarshal functions, e.g. to register msgpack, CBOR, protobuf or YAML:
+//   wget.RegisterCodec(&wget.CodecFuncs{Type: "application/msgpack", MarshalFunc: msgpack.Marshal, UnmarshalFunc: msgpack.Unmarshal})
+type CodecFuncs struct {
+	Type          string
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+func (c *CodecFuncs) ContentType() string {
+	return c.Type
+}
+
+func (c *CodecFuncs) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalFunc(v)
+}
+
+func (c *CodecFuncs) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.UnmarshalFunc(data, v)
+}
+
+// built-in codecs
+var (
+	JsonCodec Codec = jsonCodec{}
+	XmlCodec  Codec = xmlCodec{}
+	FormCodec Codec = formCodec{}
+)
+
+var codecRegistry = struct {
+	sync.RWMutex
+	codecs map[string]Codec
+}{
+	codecs: map[string]Codec{
+		"application/json": JsonCodec,
+		"text/json": JsonCodec,
+		"application/xml": XmlCodec,
+		"text/xml": XmlCodec,
+		"application/x-www-form-urlencoded": FormCodec,
+	},
+}
+
+// register codec for its content type and the optional aliases
+func RegisterCodec(codec Codec, aliases ...string) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	codecRegistry.codecs[mediaType(codec.ContentType())] = codec
+	for _, alias := range aliases {
+		codecRegistry.codecs[mediaType(alias)] = codec
+	}
+}
+
+// remove the codecs registered for the content types
+func UnregisterCodec(contentTypes ...string) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	for _, contentType := range contentTypes {
+		delete(codecRegistry.codecs, mediaType(contentType))
+	}
+}
+
+// codec of a Content-Type value, nil if not found. structured syntax suffixes
+// like "application/problem+json" are mapped to JSON or XML.
+func GetCodec(contentType string) Codec {
+	mt := mediaType(contentType)
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	if codec, ok := codecRegistry.codecs[mt]; ok {
+		return codec
+	}
+	if i := strings.LastIndexByte(mt, '+'); i >= 0 {
+		return codecRegistry.codecs["application/"+mt[i+1:]]
+	}
+	return nil
+}
+
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// request body encoded by codec, params of type io.Reader, []byte etc. are sent as is.
+func buildCodecParams(codec Codec, params interface{}) (io.ReadSeeker, error) {
+	switch v := params.(type) {
+	case io.ReadSeeker:
+		return v, nil
+	case *strings.Builder:
+		return strings.NewReader(v.String()), nil
+	case *bytes.Buffer:
+		return bytes.NewReader(v.Bytes()), nil
+	case io.WriterTo:
+		b := &bytes.Buffer{}
+		if _, err := v.WriteTo(b); err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b.Bytes()), nil
+	case io.Reader:
+		p, err := ioutil.ReadAll(v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(p), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	default:
+		p, err := codec.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) == 0 {
+			return nil, nil
+		}
+		return bytes.NewReader(p), nil
+	}
+}
+
+// ---- JSON ----
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	jsonEncoder := json.NewEncoder(buf)
+	jsonEncoder.SetEscapeHTML(false)
+	if err := jsonEncoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// ---- XML ----
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+// a string is taken as an XML document, and a flat map with string keys is encoded as
+// <xml><key>value</key>...</xml> with the keys sorted, e.g. params of WeChat Pay.
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	switch s := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(s), nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		return marshalXmlMap(rv)
+	}
+	return xml.Marshal(v)
+}
+
+func marshalXmlMap(m reflect.Value) ([]byte, error) {
+	keys := make([]string, 0, m.Len())
+	for _, k := range m.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	b := &bytes.Buffer{}
+	b.WriteString("<xml>")
+	for _, k := range keys {
+		val := m.MapIndex(reflect.ValueOf(k).Convert(m.Type().Key()))
+		for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				break
+			}
+			val = val.Elem()
+		}
+		var text string
+		switch val.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			// nil
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Func, reflect.Chan:
+			return nil, fmt.Errorf("unsupported xml value %v of key %s", val.Type(), k)
+		default:
+			text = fmt.Sprintf("%v", val.Interface())
+		}
+		fmt.Fprintf(b, "<%s>", k)
+		if err := xml.EscapeText(b, []byte(text)); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(b, "</%s>", k)
+	}
+	b.WriteString("</xml>")
+	return b.Bytes(), nil
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// ---- application/x-www-form-urlencoded ----
+type formCodec struct{}
+
+func (formCodec) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (formCodec) Marshal(v interface{}) ([]byte, error) {
+	p, err := buildHttpStringParams(v, NestedDot)
+	return []byte(p), err
+}
+
+// v must be *url.Values, *map[string][]string or *map[string]string
+func (formCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch res := v.(type) {
+	case *url.Values:
+		*res = values
+	case *map[string][]string:
+		*res = values
+	case *map[string]string:
+		m := make(map[string]string, len(values))
+		for k := range values {
+			m[k] = values.Get(k)
+		}
+		*res = m
+	default:
+		return fmt.Errorf("form can not be decoded into %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package wget
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an implementation of http.CookieJar following RFC 6265, which can be saved to
+// and loaded from a Netscape cookies.txt or JSON file.
+// cookies for a domain without any dot are rejected. if a public suffix list is given,
+// cookies for a public suffix, e.g. "co.uk", are rejected too.
+type CookieJar struct {
+	mu      sync.Mutex
+	entries map[string]*cookieEntry // key: domain;path;name
+	psList  cookiejar.PublicSuffixList
+}
+
+type cookieEntry struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	HostOnly bool      `json:"host_only"`
+	Secure   bool      `json:"secure"`
+	HttpOnly bool      `json:"http_only"`
+	Expires  time.Time `json:"expires"` // zero for session cookie
+	Creation time.Time `json:"creation"`
+}
+
+const (
+	netscape_httponly_prefix = "#HttpOnly_"
+)
+
+// psList is the same as the one of net/http/cookiejar, e.g. golang.org/x/net/publicsuffix.List.
+// no public suffix list is consulted if it is not given.
+func NewCookieJar(psList ...cookiejar.PublicSuffixList) *CookieJar {
+	j := &CookieJar{entries: make(map[string]*cookieEntry)}
+	if len(psList) > 0 {
+		j.psList = psList[0]
+	}
+	return j
+}
+
+// load cookies from a file saved by Save(), or a Netscape cookies.txt created by curl, wget or browsers.
+// an empty jar is returned if the file doesn't exist.
+func LoadCookieJar(file string, psList ...cookiejar.PublicSuffixList) (*CookieJar, error) {
+	j := NewCookieJar(psList...)
+	fp, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	r := bufio.NewReader(fp)
+	if isJsonFile(file, r) {
+		err = j.ReadJSON(r)
+	} else {
+		err = j.ReadNetscape(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// save cookies to file, in JSON if the file name ends with ".json", otherwise in Netscape format.
+func (j *CookieJar) Save(file string) error {
+	tmpFile := file + ".tmp"
+	fp, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		err = j.WriteJSON(fp)
+	} else {
+		err = j.WriteNetscape(fp)
+	}
+	if e := fp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+func isJsonFile(file string, r *bufio.Reader) bool {
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		return true
+	}
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return false
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			r.UnreadRune()
+			return true
+		default:
+			r.UnreadRune()
+			return false
+		}
+	}
+}
+
+// ---- implementation of http.CookieJar ----
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u)
+	if len(host) == 0 {
+		return
+	}
+	defPath := defaultPath(u.Path)
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, c := range cookies {
+		e, remove, ok := j.newCookieEntry(c, host, defPath, now)
+		if !ok {
+			continue
+		}
+		key := e.key()
+		if remove {
+			delete(j.entries, key)
+			continue
+		}
+		if old, ok := j.entries[key]; ok {
+			e.Creation = old.Creation
+		}
+		j.entries[key] = e
+	}
+}
+
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host := canonicalHost(u)
+	if len(host) == 0 {
+		return nil
+	}
+	reqPath := u.Path
+	if len(reqPath) == 0 {
+		reqPath = "/"
+	}
+	secure := u.Scheme == "https"
+	now := time.Now()
+
+	j.mu.Lock()
+	var selected []*cookieEntry
+	for key, e := range j.entries {
+		if e.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if e.Secure && !secure {
+			continue
+		}
+		if !e.domainMatch(host) || !pathMatch(reqPath, e.Path) {
+			continue
+		}
+		selected = append(selected, e)
+	}
+	j.mu.Unlock()
+
+	// RFC 6265 5.4: longer paths first, then earlier creation times first
+	sort.Slice(selected, func(a, b int) bool {
+		ea, eb := selected[a], selected[b]
+		if len(ea.Path) != len(eb.Path) {
+			return len(ea.Path) > len(eb.Path)
+		}
+		return ea.Creation.Before(eb.Creation)
+	})
+
+	res := make([]*http.Cookie, len(selected))
+	for i, e := range selected {
+		res[i] = &http.Cookie{Name: e.Name, Value: e.Value}
+	}
+	return res
+}
+
+// ---- RFC 6265 ----
+// remove is true if the cookie is expired and the existing one should be removed.
+func (j *CookieJar) newCookieEntry(c *http.Cookie, host, defPath string, now time.Time) (e *cookieEntry, remove bool, ok bool) {
+	if len(c.Name) == 0 && len(c.Value) == 0 {
+		return
+	}
+
+	e = &cookieEntry{
+		Name: c.Name,
+		Value: c.Value,
+		Secure: c.Secure,
+		HttpOnly: c.HttpOnly,
+		Creation: now,
+	}
+
+	// 5.3 step 3: Max-Age has precedence over Expires
+	if c.MaxAge < 0 {
+		remove = true
+	} else if c.MaxAge > 0 {
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	} else if !c.Expires.IsZero() {
+		if !c.Expires.After(now) {
+			remove = true
+		} else {
+			e.Expires = c.Expires
+		}
+	}
+
+	// 5.3 step 4-6: domain attribute
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if len(domain) > 0 && j.psList != nil {
+		// 5.3 step 5: public suffix is only allowed for the host itself
+		if ps := j.psList.PublicSuffix(domain); len(ps) > 0 && !strings.HasSuffix(domain, "."+ps) {
+			if domain != host {
+				return nil, false, false
+			}
+			domain = ""
+		}
+	}
+	if len(domain) == 0 {
+		e.Domain, e.HostOnly = host, true
+	} else {
+		if domain != host {
+			if net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain) || !strings.Contains(domain, ".") {
+				return nil, false, false
+			}
+		}
+		e.Domain = domain
+	}
+
+	// 5.3 step 7: path attribute
+	if len(c.Path) == 0 || c.Path[0] != '/' {
+		e.Path = defPath
+	} else {
+		e.Path = c.Path
+	}
+	return e, remove, true
+}
+
+func (e *cookieEntry) key() string {
+	return fmt.Sprintf("%s;%s;%s", e.Domain, e.Path, e.Name)
+}
+
+func (e *cookieEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// RFC 6265 5.1.3
+func (e *cookieEntry) domainMatch(host string) bool {
+	if host == e.Domain {
+		return true
+	}
+	if e.HostOnly {
+		return false
+	}
+	return strings.HasSuffix(host, "."+e.Domain) && net.ParseIP(host) == nil
+}
+
+// RFC 6265 5.1.4
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return cookiePath[len(cookiePath)-1] == '/' || reqPath[len(cookiePath)] == '/'
+}
+
+// RFC 6265 5.1.4
+func defaultPath(uriPath string) string {
+	if len(uriPath) == 0 || uriPath[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(uriPath, "/")
+	if i == 0 {
+		return "/"
+	}
+	return uriPath[:i]
+}
+
+func canonicalHost(u *url.URL) string {
+	return strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+}
+
+// ---- persistence ----
+func (j *CookieJar) persistentEntries() []*cookieEntry {
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	res := make([]*cookieEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if !e.expired(now) {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].key() < res[b].key()
+	})
+	return res
+}
+
+func (j *CookieJar) addEntry(e *cookieEntry) {
+	if e.expired(time.Now()) {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[e.key()] = e
+}
+
+// write cookies in Netscape cookies.txt format. session cookies are saved with expiry 0.
+func (j *CookieJar) WriteNetscape(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Netscape HTTP Cookie File\n\n")
+	for _, e := range j.persistentEntries() {
+		domain := e.Domain
+		includeSubdomains := "FALSE"
+		if !e.HostOnly {
+			domain = "." + domain
+			includeSubdomains = "TRUE"
+		}
+		if e.HttpOnly {
+			domain = netscape_httponly_prefix + domain
+		}
+		secure := "FALSE"
+		if e.Secure {
+			secure = "TRUE"
+		}
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, includeSubdomains, e.Path, secure, expires, e.Name, e.Value)
+	}
+	return bw.Flush()
+}
+
+func (j *CookieJar) ReadNetscape(r io.Reader) error {
+	now := time.Now()
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, netscape_httponly_prefix) {
+			line = line[len(netscape_httponly_prefix):]
+			httpOnly = true
+		}
+		if len(strings.TrimSpace(line)) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			return fmt.Errorf("bad cookie line #%d", lineNo)
+		}
+		if len(fields) == 6 {
+			// empty value
+			fields = append(fields, "")
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad expiry in cookie line #%d: %v", lineNo, err)
+		}
+
+		e := &cookieEntry{
+			Domain: strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path: fields[2],
+			Secure: strings.EqualFold(fields[3], "TRUE"),
+			Name: fields[5],
+			Value: fields[6],
+			HttpOnly: httpOnly,
+			Creation: now,
+		}
+		if expires > 0 {
+			e.Expires = time.Unix(expires, 0)
+		}
+		j.addEntry(e)
+	}
+	return scanner.Err()
+}
+
+func (j *CookieJar) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j.persistentEntries())
+}
+
+func (j *CookieJar) ReadJSON(r io.Reader) error {
+	var entries []*cookieEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		j.addEntry(e)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package wget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	default_chunks = 4
+	default_min_chunk_size = 1 << 20
+)
+
+// returned if the remote file is changed while it is being downloaded in chunks
+var ErrRemoteChanged = errors.New("remote file changed while downloading")
+
+// arguments for DownloadParallel
+type ParallelArgs struct {
+	DownloadArgs                // Retry is used for every chunk
+	Chunks       int            // number of concurrent Range requests, default_chunks if it is 0
+	MinChunkSize int64          // a chunk is not smaller than it, default_min_chunk_size if it is 0
+	MultiBase    *BaseUrl       // if it is set, url is relative to its items, which the chunks are spread across
+}
+
+// download url to destPath with concurrent Range requests written into a preallocated destPath.part,
+// which is renamed to destPath when it is complete. it falls back to Download if the server does
+// not advertise `Accept-Ranges: bytes` or the file is too small to be split.
+// the mirrors given by MultiBase must serve the same content with the same validators.
+func DownloadParallel(url, destPath string, options ...*ParallelArgs) error {
+	return DownloadParallelContext(context.Background(), url, destPath, options...)
+}
+
+func DownloadParallelContext(ctx context.Context, url, destPath string, options ...*ParallelArgs) error {
+	var option ParallelArgs
+	if len(options) > 0 && options[0] != nil {
+		option = *options[0]
+	}
+	d := &parallelDownloader{
+		destPath: destPath,
+		partPath: destPath + part_suffix,
+		option: option,
+		retry: option.Retry,
+	}
+	d.option.Retry = nil // retried by every chunk
+	if option.MultiBase != nil && !isHttpUrl(url) {
+		for _, item := range option.MultiBase.baseItems {
+			d.urls = append(d.urls, fmt.Sprintf("%s%s", item.baseUrl, url))
+		}
+	} else {
+		d.urls = []string{url}
+	}
+	return d.run(ctx)
+}
+
+type parallelDownloader struct {
+	destPath string
+	partPath string
+	urls     []string // the chunks are spread across them
+	option   ParallelArgs
+	retry    *RetryPolicy
+	ifRange  string
+	done     int64
+}
+
+func (d *parallelDownloader) run(ctx context.Context) error {
+	headResp, url, err := d.probe(ctx)
+	if err != nil {
+		return err
+	}
+	size := headResp.ContentLength
+	chunks := d.chunks(size)
+	if chunks < 2 || !acceptRanges(headResp) {
+		// single stream
+		downloadArgs := d.option.DownloadArgs
+		downloadArgs.Retry = d.retry
+		return DownloadContext(ctx, url, d.destPath, &downloadArgs)
+	}
+	var lastModified string
+	if _, err := GetLastModified(headResp); err == nil {
+		lastModified = headResp.Header.Get("Last-Modified")
+	}
+	d.ifRange = ifRangeValidator(headResp.Header.Get("ETag"), lastModified)
+
+	f, err := os.OpenFile(d.partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(size); err == nil {
+		err = d.fetchChunks(ctx, f, size, chunks)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		// the holes of the partial file can not be resumed
+		os.Remove(d.partPath)
+		return err
+	}
+
+	fin := &downloader{destPath: d.destPath, partPath: d.partPath, metaPath: d.destPath + meta_suffix}
+	return fin.finish(nil, headResp)
+}
+
+// HEAD the file, failed over across the urls. the url answered is returned
+func (d *parallelDownloader) probe(ctx context.Context) (resp *http.Response, url string, err error) {
+	for _, url = range d.urls {
+		fp := d.newFile(ctx, url, http.MethodHead, nil)
+		fp.run()
+		if err = fp.Err; err == nil {
+			if fp.Resp.StatusCode < 200 || fp.Resp.StatusCode >= 300 {
+				err = statusError(fp, fp.Resp)
+			}
+			fp.Resp.Body.Close()
+			if err == nil {
+				return fp.Resp, url, nil
+			}
+		}
+		if ctx.Err() != nil || !shouldFailover(err) {
+			break
+		}
+	}
+	return nil, "", err
+}
+
+func (d *parallelDownloader) newFile(ctx context.Context, url, method string, extraHeaders map[string]string) *File {
+	headers := make(map[string]string, len(d.option.Headers)+len(extraHeaders)+1)
+	for k, v := range d.option.Headers {
+		headers[k] = v
+	}
+	for k, v := range extraHeaders {
+		headers[k] = v
+	}
+	headers["Accept-Encoding"] = "identity"
+	args := d.option.Args
+	args.Headers = headers
+	return wget_fs(ctx, url, method, &args)
+}
+
+func (d *parallelDownloader) chunks(size int64) int {
+	if size <= 0 {
+		return 0
+	}
+	chunks, minChunkSize := d.option.Chunks, d.option.MinChunkSize
+	if chunks <= 0 {
+		chunks = default_chunks
+	}
+	if minChunkSize <= 0 {
+		minChunkSize = default_min_chunk_size
+	}
+	if n := size / minChunkSize; n < int64(chunks) {
+		chunks = int(n)
+	}
+	return chunks
+}
+
+func acceptRanges(resp *http.Response) bool {
+	for _, v := range resp.Header.Values("Accept-Ranges") {
+		for _, unit := range strings.Split(v, ",") {
+			if strings.TrimSpace(unit) == "bytes" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *parallelDownloader) fetchChunks(ctx context.Context, f *os.File, size int64, chunks int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stopProgress := d.startProgress(size)
+	defer stopProgress()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	chunkSize := (size + int64(chunks) - 1) / int64(chunks)
+	for i := 0; i < chunks; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		wg.Add(1)
+		go func(i int, start, end int64) {
+			defer wg.Done()
+			if err := d.fetchChunk(ctx, f, i, start, end); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// fetch bytes [start, end] with retrying, resumed from the bytes written. the i-th chunk is fetched
+// from the i-th url, and from the next one on every retry.
+func (d *parallelDownloader) fetchChunk(ctx context.Context, f *os.File, i int, start, end int64) error {
+	attempts := d.retry.attempts()
+	for attempt := 1; ; attempt++ {
+		url := d.urls[(i+attempt-1)%len(d.urls)]
+		n, err := d.fetchRange(ctx, f, url, start, end)
+		start += n
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+		if err = sleepContext(ctx, d.retry.delay(attempt, nil)); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *parallelDownloader) fetchRange(ctx context.Context, f *os.File, url string, start, end int64) (int64, error) {
+	headers := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, end)}
+	if len(d.ifRange) > 0 {
+		headers["If-Range"] = d.ifRange
+	}
+	fp := d.newFile(ctx, url, http.MethodGet, headers)
+	fp.run()
+	if fp.Err != nil {
+		return 0, fp.Err
+	}
+	resp := fp.Resp
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		rangeStart, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+		if rangeStart != start {
+			return 0, fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), start)
+		}
+	case http.StatusOK:
+		// If-Range is not matched
+		return 0, ErrRemoteChanged
+	default:
+		return 0, statusError(fp, resp)
+	}
+
+	w := &chunkWriter{f: f, off: start, done: &d.done}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, end-start+1))
+	if err == nil && n != end-start+1 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// report the progress periodically until the returned func is called
+func (d *parallelDownloader) startProgress(size int64) (stop func()) {
+	fn := d.option.Progress
+	if fn == nil {
+		return func() {}
+	}
+	interval := d.option.ProgressInterval
+	if interval <= 0 {
+		interval = default_progress_interval
+	}
+
+	started := time.Now()
+	report := func() {
+		done := atomic.LoadInt64(&d.done)
+		var rate float64
+		if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+			rate = float64(done) / elapsed
+		}
+		fn(done, size, rate)
+	}
+
+	ticker := time.NewTicker(interval)
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(quit)
+		<-finished
+		report()
+	}
+}
+
+// writes to f from off
+type chunkWriter struct {
+	f    *os.File
+	off  int64
+	done *int64
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	atomic.AddInt64(w.done, int64(n))
+	return n, err
+}
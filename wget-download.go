@@ -0,0 +1,303 @@
+package wget
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	part_suffix = ".part"
+	meta_suffix = ".part.meta"
+	default_progress_interval = 500 * time.Millisecond
+)
+
+// called with the bytes downloaded, the total bytes (-1 if unknown) and the rate in bytes per second
+type ProgressFunc func(done, total int64, rate float64)
+
+// arguments for Download
+type DownloadArgs struct {
+	Args                            // Params, Headers, Retry etc. of the request. Retry is also used to resume after a broken transfer
+	Progress         ProgressFunc   // called at most once per ProgressInterval, and once more when it is done
+	ProgressInterval time.Duration  // default_progress_interval if it is 0
+}
+
+// validators of the partial file, saved as destPath.part.meta
+type downloadMeta struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Total        int64  `json:"total"`
+}
+
+// download url to destPath like `wget -c`. the content is written to destPath.part, which is resumed
+// with Range/If-Range if it exists, and renamed to destPath when it is complete. the mtime of destPath
+// is set by the Last-Modified of the response.
+func Download(url, destPath string, options ...*DownloadArgs) error {
+	return DownloadContext(context.Background(), url, destPath, options...)
+}
+
+func DownloadContext(ctx context.Context, url, destPath string, options ...*DownloadArgs) error {
+	d := &downloader{ctx: ctx, url: url, destPath: destPath, partPath: destPath + part_suffix, metaPath: destPath + meta_suffix}
+	if len(options) > 0 && options[0] != nil {
+		d.option = *options[0]
+	}
+	retry := d.option.Retry
+	d.option.Retry = nil // retried by resuming
+
+	attempts := retry.attempts()
+	for attempt := 1; ; attempt++ {
+		err := d.download(true)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+		if err = sleepContext(ctx, retry.delay(attempt, nil)); err != nil {
+			return err
+		}
+	}
+}
+
+type downloader struct {
+	ctx      context.Context
+	url      string
+	destPath string
+	partPath string
+	metaPath string
+	option   DownloadArgs
+}
+
+func (d *downloader) download(resumable bool) error {
+	var offset int64
+	meta := d.loadMeta()
+	if _, err := os.Stat(d.metaPath); err == nil && meta == nil {
+		// partial file of another url
+		resumable = false
+	}
+	if fi, err := os.Stat(d.partPath); err == nil && resumable {
+		offset = fi.Size()
+	}
+
+	headers := make(map[string]string, len(d.option.Headers)+3)
+	for k, v := range d.option.Headers {
+		headers[k] = v
+	}
+	headers["Accept-Encoding"] = "identity" // offsets are of the raw content
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		if meta != nil {
+			if ifRange := ifRangeValidator(meta.ETag, meta.LastModified); len(ifRange) > 0 {
+				headers["If-Range"] = ifRange
+			}
+		}
+	}
+
+	args := d.option.Args
+	args.Headers = headers
+	fp := wget_fs(d.ctx, d.url, http.MethodGet, &args)
+	fp.run()
+	if fp.Err != nil {
+		return fp.Err
+	}
+	resp := fp.Resp
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != offset {
+			return fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		total = size
+		if meta == nil {
+			d.saveMeta(resp, total)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset == 0 {
+			// not caused by Range
+			return statusError(fp, resp)
+		}
+		if _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && size == offset {
+			// downloaded already
+			return d.finish(meta, nil)
+		}
+		// the remote file is changed, download it again without Range
+		return d.download(false)
+	case http.StatusOK:
+		offset = 0
+		total = resp.ContentLength
+		d.saveMeta(resp, total)
+	default:
+		return statusError(fp, resp)
+	}
+
+	flag := os.O_WRONLY|os.O_CREATE|os.O_APPEND
+	if offset == 0 {
+		flag = os.O_WRONLY|os.O_CREATE|os.O_TRUNC
+	}
+	f, err := os.OpenFile(d.partPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	pw := newProgressWriter(f, offset, total, d.option.Progress, d.option.ProgressInterval)
+	_, err = io.Copy(pw, resp.Body)
+	pw.report()
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if total >= 0 && pw.done != total {
+		return io.ErrUnexpectedEOF
+	}
+	return d.finish(meta, resp)
+}
+
+// *HTTPError of an unexpected status
+func statusError(fp *File, resp *http.Response) error {
+	option := fp.options
+	option.ErrorOnNon2xx = true
+	if err := checkStatus(resp, JsonCodec, &option); err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// rename the partial file to destPath and set its mtime
+func (d *downloader) finish(meta *downloadMeta, resp *http.Response) error {
+	if err := os.Rename(d.partPath, d.destPath); err != nil {
+		return err
+	}
+	os.Remove(d.metaPath)
+
+	var lastModified time.Time
+	var err error
+	if resp != nil {
+		lastModified, err = GetLastModified(resp)
+	} else if meta != nil {
+		lastModified, err = http.ParseTime(meta.LastModified)
+	} else {
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return os.Chtimes(d.destPath, time.Now(), lastModified)
+}
+
+// the meta is ignored if it is not of d.url
+func (d *downloader) loadMeta() *downloadMeta {
+	b, err := ioutil.ReadFile(d.metaPath)
+	if err != nil {
+		return nil
+	}
+	var meta downloadMeta
+	if err = json.Unmarshal(b, &meta); err != nil || meta.Url != d.url {
+		return nil
+	}
+	return &meta
+}
+
+func (d *downloader) saveMeta(resp *http.Response, total int64) {
+	meta := &downloadMeta{
+		Url: d.url,
+		ETag: resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Total: total,
+	}
+	if b, err := json.Marshal(meta); err == nil {
+		ioutil.WriteFile(d.metaPath, b, 0644)
+	}
+}
+
+// value of If-Range: ETag if it is a strong one, otherwise Last-Modified
+func ifRangeValidator(etag, lastModified string) string {
+	if len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return lastModified
+}
+
+// start and complete length of "bytes start-end/size" or "bytes */size". size is -1 if it is "*".
+func parseContentRange(contentRange string) (start, size int64, err error) {
+	const unit = "bytes "
+	if !strings.HasPrefix(contentRange, unit) {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+	r := contentRange[len(unit):]
+	slash := strings.IndexByte(r, '/')
+	if slash < 0 {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+	if sz := r[slash+1:]; sz == "*" {
+		size = -1
+	} else if size, err = strconv.ParseInt(sz, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+	if rng := r[:slash]; rng != "*" {
+		dash := strings.IndexByte(rng, '-')
+		if dash < 0 {
+			return 0, 0, fmt.Errorf("bad Content-Range %q", contentRange)
+		}
+		if start, err = strconv.ParseInt(rng[:dash], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("bad Content-Range %q", contentRange)
+		}
+	}
+	return start, size, nil
+}
+
+// a writer calling fn with the progress
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	fn       ProgressFunc
+	interval time.Duration
+
+	started  time.Time
+	lastTime time.Time
+	written  int64 // by this writer, for the rate
+}
+
+func newProgressWriter(w io.Writer, done, total int64, fn ProgressFunc, interval time.Duration) *progressWriter {
+	if interval <= 0 {
+		interval = default_progress_interval
+	}
+	now := time.Now()
+	return &progressWriter{w: w, done: done, total: total, fn: fn, interval: interval, started: now, lastTime: now}
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	pw.written += int64(n)
+	if pw.fn != nil {
+		if now := time.Now(); now.Sub(pw.lastTime) >= pw.interval {
+			pw.lastTime = now
+			pw.report()
+		}
+	}
+	return n, err
+}
+
+func (pw *progressWriter) report() {
+	if pw.fn == nil {
+		return
+	}
+	var rate float64
+	if elapsed := time.Since(pw.started).Seconds(); elapsed > 0 {
+		rate = float64(pw.written) / elapsed
+	}
+	pw.fn(pw.done, pw.total, rate)
+}
@@ -0,0 +1,14 @@
+//go:build go1.20
+
+package wget
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// *tls.CertificateVerificationError is added in go1.20
+func isCertificateVerificationError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	return errors.As(err, &verifyErr)
+}
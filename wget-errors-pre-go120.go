@@ -0,0 +1,7 @@
+//go:build !go1.20
+
+package wget
+
+func isCertificateVerificationError(err error) bool {
+	return false
+}
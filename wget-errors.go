@@ -0,0 +1,115 @@
+package wget
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// classifiers of errors returned by the request functions. when a request fails without
+// any HTTP response, e.g. DNS failure or connection refused, status 0 is returned with the error.
+
+// whether err is caused by a timeout, including Options.Timeout, Timeouts and deadline of the context.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// whether the connection is refused by the server or proxy.
+func IsConnRefused(err error) bool {
+	return err != nil && errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// whether the host name can not be resolved.
+func IsDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return err != nil && errors.As(err, &dnsErr)
+}
+
+// whether the TLS handshake fails, e.g. the server certificate can not be verified.
+func IsTLSError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+		hostnameErr  x509.HostnameError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr) || isCertificateVerificationError(err)
+}
+
+// whether the request may succeed if it is sent again or to another server: timeouts,
+// connection failures, temporary DNS failures, ErrRateLimited and *HTTPError with a status of DefaultRetryStatus.
+// it is false for cancelled requests, TLS errors, ErrBodyTooLarge and invalid requests.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrBodyTooLarge) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		for _, status := range DefaultRetryStatus {
+			if httpErr.Status == status {
+				return true
+			}
+		}
+		return false
+	}
+
+	if IsTimeout(err) || IsConnRefused(err) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.Temporary() || dnsErr.Timeout()
+	}
+	if IsTLSError(err) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// whether the request failed before anything is sent to the server
+func notSent(err error) bool {
+	if errors.Is(err, ErrRateLimited) || IsDNSError(err) || IsConnRefused(err) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// error of building the request, which fails the same way on any server
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// whether BaseUrl should send the request to the next item after err
+func shouldFailover(err error) bool {
+	var reqErr *requestError
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrBodyTooLarge) && !errors.As(err, &reqErr)
+}
@@ -0,0 +1,276 @@
+package wget
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how nested values are named when encoding form or query params
+type NestedStyle int
+
+const (
+	NestedDot     NestedStyle = iota // a.b=c, slice: a=1&a=2, slice of structs: a.0.b=c
+	NestedBracket                    // a[b]=c, slice: a=1&a=2, slice of structs: a[0][b]=c
+	NestedPHP                        // a[b]=c, slice: a[]=1&a[]=2, slice of structs: a[0][b]=c
+)
+
+const (
+	form_tag        = "form"
+	time_format_tag = "time_format"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// encode struct, map with string keys or pointer to them. fields of struct are named by tag
+// `form:"name,omitempty"`, and time.Time fields are formatted with tag `time_format:"2006-01-02"`,
+// time.RFC3339 by default.
+func encodeForm(params interface{}, style NestedStyle) (url.Values, error) {
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return url.Values{}, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		if v.Kind() == reflect.Map && v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		values := url.Values{}
+		if err := encodeFormValue(values, "", v, "", style); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown type to build http params")
+}
+
+func encodeFormValue(values url.Values, key string, v reflect.Value, timeFormat string, style NestedStyle) error {
+	for {
+		if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				if v.Kind() == reflect.Interface {
+					// same as "%v", e.g. nil in map[string]interface{}
+					values.Add(key, "<nil>")
+				} else {
+					values.Add(key, "")
+				}
+				return nil
+			}
+		}
+		if ok, err := encodeFormText(values, key, v, timeFormat); ok {
+			return err
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			break
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		n, err := encodeFormStruct(values, key, v, style)
+		if err == nil && n == 0 {
+			return fmt.Errorf("no exported field of %v to encode %s", v.Type(), key)
+		}
+		return err
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %v of %s", v.Type().Key(), key)
+		}
+		for _, k := range v.MapKeys() {
+			if err := encodeFormValue(values, nestedKey(key, k.String(), style), v.MapIndex(k), "", style); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte or [N]byte
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			values.Add(key, string(b))
+			return nil
+		}
+		for i:=0; i<v.Len(); i++ {
+			elem := v.Index(i)
+			elemKey := key
+			if isCompositeValue(elem) {
+				elemKey = nestedKey(key, strconv.Itoa(i), style)
+			} else if style == NestedPHP {
+				elemKey = key + "[]"
+			}
+			if err := encodeFormValue(values, elemKey, elem, timeFormat, style); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		values.Add(key, v.String())
+	case reflect.Bool:
+		values.Add(key, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		values.Add(key, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		values.Add(key, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32:
+		values.Add(key, strconv.FormatFloat(v.Float(), 'g', -1, 32))
+	case reflect.Float64:
+		values.Add(key, strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	default:
+		return fmt.Errorf("unsupported type %v of %s", v.Type(), key)
+	}
+	return nil
+}
+
+// time.Time, encoding.TextMarshaler and fmt.Stringer are encoded as text, except the params themselves
+func encodeFormText(values url.Values, key string, v reflect.Value, timeFormat string) (bool, error) {
+	if len(key) == 0 || !v.CanInterface() {
+		return false, nil
+	}
+	switch t := v.Interface().(type) {
+	case time.Time:
+		if len(timeFormat) == 0 {
+			timeFormat = time.RFC3339
+		}
+		values.Add(key, t.Format(timeFormat))
+		return true, nil
+	case *time.Time:
+		// formatted with timeFormat after dereferenced
+		return false, nil
+	case encoding.TextMarshaler:
+		text, err := t.MarshalText()
+		if err == nil {
+			values.Add(key, string(text))
+		}
+		return true, err
+	case fmt.Stringer:
+		values.Add(key, t.String())
+		return true, nil
+	}
+	return false, nil
+}
+
+// n is the number of fields encoded or skipped by tag, fields of embedded structs included.
+func encodeFormStruct(values url.Values, key string, v reflect.Value, style NestedStyle) (n int, err error) {
+	t := v.Type()
+	for i:=0; i<t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			// unexported
+			continue
+		}
+		tag := field.Tag.Get(form_tag)
+		if tag == "-" {
+			n++
+			continue
+		}
+		name, omitEmpty := parseFormTag(tag)
+		fv := v.Field(i)
+		if omitEmpty && isEmptyValue(fv) {
+			n++
+			continue
+		}
+
+		if field.Anonymous && len(name) == 0 {
+			// fields of embedded struct are promoted
+			ev := fv
+			for ev.Kind() == reflect.Ptr {
+				if ev.IsNil() {
+					break
+				}
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Struct && ev.Type() != timeType {
+				m, err := encodeFormStruct(values, key, ev, style)
+				if err != nil {
+					return n, err
+				}
+				n += m
+				continue
+			}
+			if len(field.PkgPath) > 0 {
+				continue
+			}
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+		if err = encodeFormValue(values, nestedKey(key, name, style), fv, field.Tag.Get(time_format_tag), style); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func parseFormTag(tag string) (name string, omitEmpty bool) {
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty
+}
+
+func nestedKey(prefix, name string, style NestedStyle) string {
+	if len(prefix) == 0 {
+		return name
+	}
+	if style == NestedDot {
+		return prefix + "." + name
+	}
+	return prefix + "[" + name + "]"
+}
+
+func isCompositeValue(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return v.Type() != timeType && !v.Type().Implements(textMarshalerType) && !v.Type().Implements(stringerType)
+	case reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -3,12 +3,12 @@
 package wget
 
 import (
+	"context"
 	"io"
-	"encoding/json"
 )
 
 func FsCall(url string, method string, options ...*Args) (status int, body io.ReadCloser, err error) {
-	fp := wget_fs(url, method, options...)
+	fp := wget_fs(context.Background(), url, method, options...)
 	fi, e := fp.Stat()
 	if e != nil {
 		err = e
@@ -20,15 +20,34 @@ func FsCall(url string, method string, options ...*Args) (status int, body io.Re
 }
 
 func FsCallAndParseJSON(url string, method string, res interface{}, options ...*Args) (status int, err error) {
-	var body io.ReadCloser
-	status, body, err = FsCall(url, method, options...)
-	if err != nil || body == nil {
+	return fsCallAndDecode(url, method, JsonCodec, res, options...)
+}
+
+func FsCallAndParseXML(url string, method string, res interface{}, options ...*Args) (status int, err error) {
+	return fsCallAndDecode(url, method, XmlCodec, res, options...)
+}
+
+func fsCallAndDecode(url string, method string, codec Codec, res interface{}, options ...*Args) (status int, err error) {
+	fp := wget_fs(context.Background(), url, method, options...)
+	fp.run()
+	status, err = fp.Status, fp.Err
+	if err != nil {
+		return
+	}
+	if len(options) > 0 && options[0] != nil {
+		fp.options.DebugWriter = options[0].Logger
+	}
+	if err = checkStatus(fp.Resp, codec, &fp.options); err != nil {
+		return
+	}
+	body := fp.Resp.Body
+	if body == nil {
 		return
 	}
 	defer body.Close()
 
 	if len(options) == 0 || options[0] == nil || options[0].Logger == nil {
-		err = json.NewDecoder(body).Decode(res)
+		err = codec.Decode(body, res)
 		return
 	}
 
@@ -36,5 +55,5 @@ func FsCallAndParseJSON(url string, method string, res interface{}, options ...*
 	io.WriteString(w, "body: ")
 	r := io.TeeReader(body, w)
 	defer io.WriteString(w, "\n")
-	return status, json.NewDecoder(r).Decode(res)
+	return status, codec.Decode(r, res)
 }
@@ -3,6 +3,7 @@
 package wget
 
 import (
+	"context"
 	// "io/fs"
 	"io"
 	"os"
@@ -18,7 +19,20 @@ type Args struct {
 	Headers map[string]string
 	Timeout int
 	JsonCall bool
+	XmlCall bool // params are sent as XML if JsonCall is false
 	Logger io.Writer
+	Retry *RetryPolicy
+	CookieJar http.CookieJar
+	Proxy string
+	TLS *TLSOptions
+	Timeouts *Timeouts // fine-grained timeouts, Timeout in seconds is same as Timeouts.Overall
+	MaxBodyBytes int64
+	NestedStyle NestedStyle
+	ParamsHook ParamsHook
+	ErrorOnNon2xx bool  // for FsCallAndParseJSON/FsCallAndParseXML, cf. Options.ErrorOnNon2xx
+	ExpectStatus []int
+	ErrorResult interface{}
+	Cache Cache
 }
 
 // result of HTTP response, returned by FileInfo.Sys()
@@ -29,31 +43,44 @@ type Result struct {
 }
 
 func HttpRequest(url string, method string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, method, options...)
+	return wget_fs(context.Background(), url, method, options...)
+}
+
+func HttpRequestContext(ctx context.Context, url string, method string, options ...*Args) *File /*fs.File*/ {
+	return wget_fs(ctx, url, method, options...)
 }
 
 func Get(url string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, http.MethodGet, options...)
+	return wget_fs(context.Background(), url, http.MethodGet, options...)
 }
 
 func Post(url string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, http.MethodPost, options...)
+	return wget_fs(context.Background(), url, http.MethodPost, options...)
 }
 
 func Put(url string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, http.MethodPut, options...)
+	return wget_fs(context.Background(), url, http.MethodPut, options...)
 }
 
 func Delete(url string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, http.MethodPut, options...)
+	return wget_fs(context.Background(), url, http.MethodPut, options...)
+}
+
+func GetContext(ctx context.Context, url string, options ...*Args) *File /*fs.File*/ {
+	return wget_fs(ctx, url, http.MethodGet, options...)
+}
+
+func PostContext(ctx context.Context, url string, options ...*Args) *File /*fs.File*/ {
+	return wget_fs(ctx, url, http.MethodPost, options...)
 }
 
 func Head(url string, options ...*Args) *File /*fs.File*/ {
-	return wget_fs(url, http.MethodHead, options...)
+	return wget_fs(context.Background(), url, http.MethodHead, options...)
 }
 
-func wget_fs(url string, method string, options ...*Args) *File /*fs.File*/ {
+func wget_fs(ctx context.Context, url string, method string, options ...*Args) *File /*fs.File*/ {
 	f := &File{
+		ctx: ctx,
 		method: method,
 		url: url,
 	}
@@ -76,12 +103,15 @@ func (wfs *wfs_t) Open(name string) (fs.File, error) {
 
 // ---- implementation of fs.File ----
 type File struct {
+	ctx context.Context
 	method string
 	url string
 	jsonCall bool
+	xmlCall bool
 	params interface{}
 	headers map[string]string
-	timeout int
+	options Options
+	done bool
 
 	Result
 }
@@ -124,22 +154,42 @@ func (f *File) setOptions(options []*Args) {
 	option := options[0]
 	f.params = option.Params
 	f.headers = option.Headers
-	f.timeout = option.Timeout
 	f.jsonCall = option.JsonCall
+	f.xmlCall = option.XmlCall
+	f.options = Options{
+		Timeout: option.Timeout,
+		Timeouts: option.Timeouts,
+		Retry: option.Retry,
+		CookieJar: option.CookieJar,
+		Proxy: option.Proxy,
+		TLS: option.TLS,
+		MaxBodyBytes: option.MaxBodyBytes,
+		NestedStyle: option.NestedStyle,
+		ParamsHook: option.ParamsHook,
+		ErrorOnNon2xx: option.ErrorOnNon2xx,
+		ExpectStatus: option.ExpectStatus,
+		ErrorResult: option.ErrorResult,
+		Cache: option.Cache,
+	}
 }
 
 func (f *File) run() {
-	if f.Status > 0 {
+	if f.done {
 		return
 	}
+	f.done = true
 
-	var call HttpFunc
+	var call HttpFuncContext
 	if f.jsonCall {
-		call = PostJson
+		call = PostJsonContext
+	} else if f.xmlCall {
+		call = PostXmlContext
 	} else {
-		call = Wget
+		call = WgetContext
 	}
-	f.Status, _, f.Resp, f.Err = call(f.url, f.method, f.params, f.headers, Options{Timeout: f.timeout, DontReadRespBody: true})
+	options := f.options
+	options.DontReadRespBody = true
+	f.Status, _, f.Resp, f.Err = call(f.ctx, f.url, f.method, f.params, f.headers, options)
 }
 
 // ---- implementation of fs.FileInfo ----
@@ -0,0 +1,50 @@
+package wget
+
+import (
+	"context"
+	"net/http"
+)
+
+// meta of the response returned by Do
+type Response struct {
+	Status int            // 0 if there's no HTTP response
+	Header http.Header
+	Resp   *http.Response // its body is consumed already
+}
+
+// typed call: req is sent as JSON, no body is sent if it is nil. the response body is decoded
+// into Resp by the codec registered for the response Content-Type, JSON by default.
+// a Resp of []byte or string gets the raw body.
+//   user, resp, err := wget.Do[User](url, "GET", nil)
+func Do[Resp any](url, method string, req any, options ...Options) (Resp, *Response, error) {
+	return DoContext[Resp](context.Background(), url, method, req, options...)
+}
+
+func DoContext[Resp any](ctx context.Context, url, method string, req any, options ...Options) (Resp, *Response, error) {
+	var res Resp
+	status, resp, err := callContext(ctx, url, method, nil, req, &res, true, options...)
+	return res, newResponse(status, resp), err
+}
+
+// same as Do with uri relative to the items of b, which is failed over.
+//   user, resp, err := wget.DoBase[User](multiBase, "/user/1", "GET", nil)
+func DoBase[Resp any](b *BaseUrl, uri, method string, req any, options ...Options) (Resp, *Response, error) {
+	return DoBaseContext[Resp](context.Background(), b, uri, method, req, options...)
+}
+
+func DoBaseContext[Resp any](ctx context.Context, b *BaseUrl, uri, method string, req any, options ...Options) (Resp, *Response, error) {
+	var option Options
+	if len(options) > 0 {
+		option = options[0]
+	}
+	option.MultiBase = b
+	return DoContext[Resp](ctx, uri, method, req, option)
+}
+
+func newResponse(status int, resp *http.Response) *Response {
+	r := &Response{Status: status, Resp: resp}
+	if resp != nil {
+		r.Header = resp.Header
+	}
+	return r
+}
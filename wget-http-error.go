@@ -0,0 +1,77 @@
+package wget
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	max_error_body_bytes = 4096
+)
+
+// returned by the decoding helpers like HttpCallJ, JsonCallJ, Call and FsCallAndParseJSON
+// when Options.ErrorOnNon2xx or Options.ExpectStatus is set and the status is not expected.
+// it can be checked with errors.As:
+//   var httpErr *wget.HTTPError
+//   if errors.As(err, &httpErr) { ... httpErr.Status ... }
+type HTTPError struct {
+	Status      int
+	Header      http.Header
+	Body        []byte      // at most max_error_body_bytes of the response body
+	ErrorResult interface{} // Options.ErrorResult if the body is decoded into it successfully, otherwise nil
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("unexpected status %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("unexpected status %d %s: %s", e.Status, http.StatusText(e.Status), e.Body)
+}
+
+// whether status is expected by option. any status is expected if neither ExpectStatus nor ErrorOnNon2xx is set.
+func statusExpected(status int, option *Options) bool {
+	if len(option.ExpectStatus) > 0 {
+		for _, s := range option.ExpectStatus {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+	if option.ErrorOnNon2xx {
+		return status >= 200 && status < 300
+	}
+	return true
+}
+
+// an *HTTPError is returned and the body is closed if status of resp is not expected,
+// the error body is decoded into option.ErrorResult with the codec of its Content-Type, or codec.
+func checkStatus(resp *http.Response, codec Codec, option *Options) error {
+	if statusExpected(resp.StatusCode, option) {
+		return nil
+	}
+
+	httpErr := &HTTPError{Status: resp.StatusCode, Header: resp.Header}
+	if resp.Body == nil {
+		return httpErr
+	}
+	defer resp.Body.Close()
+
+	httpErr.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, max_error_body_bytes))
+	if option.DebugWriter != nil {
+		fmt.Fprintf(option.DebugWriter, "body: %s\n", httpErr.Body)
+	}
+	if option.ErrorResult == nil || len(httpErr.Body) == 0 {
+		return httpErr
+	}
+	if c := GetCodec(resp.Header.Get("Content-Type")); c != nil {
+		codec = c
+	}
+	if err := codec.Decode(bytes.NewReader(httpErr.Body), option.ErrorResult); err == nil {
+		httpErr.ErrorResult = option.ErrorResult
+	}
+	return httpErr
+}
@@ -0,0 +1,96 @@
+package wget
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// where the params of a request method are put by adjustHttpArgs
+type ParamsIn int
+
+const (
+	ParamsInQuery ParamsIn = iota // appended to the url as a query string
+	ParamsInBody                  // sent as the request body
+)
+
+var methodRegistry = struct {
+	sync.RWMutex
+	methods  map[string]ParamsIn
+	allowAny bool
+}{
+	methods: map[string]ParamsIn{
+		http.MethodGet:     ParamsInQuery,
+		http.MethodHead:    ParamsInQuery,
+		http.MethodOptions: ParamsInQuery,
+		http.MethodTrace:   ParamsInQuery,
+		http.MethodPost:    ParamsInBody,
+		http.MethodPut:     ParamsInBody,
+		http.MethodDelete:  ParamsInBody,
+		http.MethodPatch:   ParamsInBody,
+
+		// WebDAV
+		"PROPFIND":  ParamsInBody,
+		"PROPPATCH": ParamsInBody,
+		"MKCOL":     ParamsInBody,
+		"COPY":      ParamsInQuery,
+		"MOVE":      ParamsInQuery,
+		"LOCK":      ParamsInBody,
+		"UNLOCK":    ParamsInQuery,
+		"REPORT":    ParamsInBody,
+		"SEARCH":    ParamsInBody,
+
+		// CDN cache purging
+		"PURGE": ParamsInQuery,
+	},
+}
+
+// register an extra request method, or change where the params of a registered one are put
+func RegisterMethod(method string, paramsIn ParamsIn) {
+	methodRegistry.Lock()
+	defer methodRegistry.Unlock()
+	methodRegistry.methods[strings.ToUpper(method)] = paramsIn
+}
+
+// remove a registered request method
+func UnregisterMethod(method string) {
+	methodRegistry.Lock()
+	defer methodRegistry.Unlock()
+	delete(methodRegistry.methods, strings.ToUpper(method))
+}
+
+// accept any request method even if it is not registered. params of such methods are sent as body.
+func AllowAnyMethod(allow bool) {
+	methodRegistry.Lock()
+	defer methodRegistry.Unlock()
+	methodRegistry.allowAny = allow
+}
+
+func methodParamsIn(method string) (paramsIn ParamsIn, ok bool) {
+	methodRegistry.RLock()
+	defer methodRegistry.RUnlock()
+	if paramsIn, ok = methodRegistry.methods[method]; ok {
+		return
+	}
+	return ParamsInBody, methodRegistry.allowAny
+}
+
+func methodAllowed(method string) bool {
+	_, ok := methodParamsIn(method)
+	return ok
+}
+
+// methods without side effects on the server, RFC 9110 section 9.2.1 and RFC 4918
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+	"SEARCH":           true,
+}
+
+func safeMethod(method string) bool {
+	return safeMethods[method]
+}
@@ -0,0 +1,65 @@
+package wget
+
+import (
+	"net/http"
+	"sync"
+)
+
+// sends a request and gets its response, just like http.Client.Do
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// a middleware wraps the next RoundTripFunc. it can change the request before calling next,
+// inspect the response after that, or return a response without calling next at all.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+var globalMiddlewares = struct {
+	sync.RWMutex
+	middlewares []Middleware
+}{}
+
+// register middlewares applied to all requests
+func Use(middlewares ...Middleware) {
+	globalMiddlewares.Lock()
+	defer globalMiddlewares.Unlock()
+	globalMiddlewares.middlewares = append(globalMiddlewares.middlewares, middlewares...)
+}
+
+// register middlewares applied to requests sent by wget
+func (wget *Request) Use(middlewares ...Middleware) *Request {
+	wget.middlewares = append(wget.middlewares, middlewares...)
+	return wget
+}
+
+// register middlewares applied to requests sent to any base url of b
+func (b *BaseUrl) Use(middlewares ...Middleware) *BaseUrl {
+	b.middlewares = append(b.middlewares, middlewares...)
+	return b
+}
+
+// chain of middlewares around client.Do. the order is global ones, the ones of
+// Request (or BaseUrl), then Options.Middlewares. the first one is the outermost.
+// the cache of Options.Cache and the rate limiters are the innermost.
+func (wget *Request) roundTrip() RoundTripFunc {
+	var rt RoundTripFunc = wget.client.Do
+
+	rt = rateLimitMiddleware(wget.limiter, wget.options != nil && wget.options.RateLimitNoWait)(rt)
+	if wget.options != nil {
+		if wget.options.Cache != nil {
+			limits := cacheLimits{maxBodyBytes: wget.options.MaxBodyBytes, idleRead: wget.idleReadTimeout}
+			rt = cacheMiddleware(wget.options.Cache, wget.options.CookieJar, limits)(rt)
+		}
+		rt = chainMiddlewares(rt, wget.options.Middlewares)
+	}
+	rt = chainMiddlewares(rt, wget.middlewares)
+
+	globalMiddlewares.RLock()
+	defer globalMiddlewares.RUnlock()
+	return chainMiddlewares(rt, globalMiddlewares.middlewares)
+}
+
+func chainMiddlewares(rt RoundTripFunc, middlewares []Middleware) RoundTripFunc {
+	for i:=len(middlewares)-1; i>=0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
@@ -0,0 +1,373 @@
+package wget
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	default_mirror_depth = 5
+)
+
+// arguments for Mirror
+type MirrorArgs struct {
+	Args                  // Headers, Timeout, CookieJar etc. of every request. failures are logged to Logger
+	MaxDepth     int      // levels of links followed from the start url, default_mirror_depth if it is 0, no limit if it is negative
+	Domains      []string // hosts followed besides the one of the start url, "*.example.com" matches the subdomains
+	PathPrefix   string   // only urls with path starting with it are followed, no limit if it is empty
+	ConvertLinks bool     // rewrite links in the saved HTML and CSS for offline browsing, like `wget -k`
+}
+
+var (
+	htmlLinkRegexp = regexp.MustCompile(`(?i)\s(href|src|srcset)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	cssLinkRegexp  = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^\s"')]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// mirror the site from startURL into dir like `wget -r`. pages are saved as dir/host/path,
+// or dir/host_port/path for a non-default port. links are extracted from HTML (href, src, srcset) and CSS (url(), @import), and followed within
+// the limits of MirrorArgs, pages redirected out of the limits are skipped. only the error of startURL
+// is returned, the others are logged to Args.Logger.
+func Mirror(startURL, dir string, options ...*MirrorArgs) error {
+	return MirrorContext(context.Background(), startURL, dir, options...)
+}
+
+func MirrorContext(ctx context.Context, startURL, dir string, options ...*MirrorArgs) error {
+	start, err := url.Parse(startURL)
+	if err != nil {
+		return err
+	}
+	if start.Scheme != "http" && start.Scheme != "https" {
+		return fmt.Errorf("url %s is not http or https", startURL)
+	}
+
+	m := &mirror{dir: dir, start: start, visited: map[string]bool{}, saved: map[string]string{}}
+	if len(options) > 0 && options[0] != nil {
+		m.option = *options[0]
+	}
+	if m.option.MaxDepth == 0 {
+		m.option.MaxDepth = default_mirror_depth
+	}
+	return m.run(ctx)
+}
+
+type mirror struct {
+	dir     string
+	start   *url.URL
+	option  MirrorArgs
+	visited map[string]bool
+	saved   map[string]string // url -> local path
+	docs    []*mirrorDoc      // saved HTML and CSS, for converting links
+}
+
+type mirrorDoc struct {
+	u         *url.URL
+	localPath string
+	isHTML    bool
+}
+
+type mirrorLink struct {
+	u     *url.URL
+	depth int
+}
+
+func (m *mirror) run(ctx context.Context) error {
+	start := *m.start
+	start.Fragment = ""
+	queue := []mirrorLink{{u: &start, depth: 0}}
+	m.visited[start.String()] = true
+
+	for i := 0; len(queue) > 0; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		link := queue[0]
+		queue = queue[1:]
+
+		links, err := m.fetch(ctx, link.u)
+		if err != nil {
+			if i == 0 {
+				return err
+			}
+			m.logf("mirror %s: %v\n", link.u, err)
+			continue
+		}
+		if m.option.MaxDepth > 0 && link.depth >= m.option.MaxDepth {
+			continue
+		}
+		for _, u := range links {
+			if key := u.String(); !m.visited[key] && m.follow(u) {
+				m.visited[key] = true
+				queue = append(queue, mirrorLink{u: u, depth: link.depth + 1})
+			}
+		}
+	}
+
+	if m.option.ConvertLinks {
+		m.convertLinks()
+	}
+	return nil
+}
+
+// save u and return the links in it
+func (m *mirror) fetch(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	fp := wget_fs(ctx, u.String(), http.MethodGet, &m.option.Args)
+	fp.run()
+	if fp.Err != nil {
+		return nil, fp.Err
+	}
+	resp := fp.Resp
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{Status: resp.StatusCode, Header: resp.Header}
+	}
+
+	finalURL := u
+	if resp.Request != nil && resp.Request.URL != nil && resp.Request.URL.String() != u.String() {
+		// redirected
+		finalURL = resp.Request.URL
+		if !m.follow(finalURL) {
+			return nil, fmt.Errorf("redirected to %s out of the limits", finalURL)
+		}
+	}
+	contentType := mediaType(resp.Header.Get("Content-Type"))
+	isHTML := contentType == "text/html" || contentType == "application/xhtml+xml"
+	isCSS := contentType == "text/css"
+
+	localPath := m.localPath(finalURL, isHTML)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return nil, err
+	}
+	m.saved[u.String()] = localPath
+	m.saved[finalURL.String()] = localPath
+
+	if !isHTML && !isCSS {
+		return nil, saveFile(localPath, resp.Body)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(localPath, content, 0644); err != nil {
+		return nil, err
+	}
+	m.docs = append(m.docs, &mirrorDoc{u: finalURL, localPath: localPath, isHTML: isHTML})
+
+	var links []*url.URL
+	rewriteLinks(string(content), isHTML, func(link string) string {
+		if ref := resolveLink(finalURL, link); ref != nil {
+			links = append(links, ref)
+		}
+		return link
+	})
+	return links, nil
+}
+
+func saveFile(localPath string, r io.Reader) error {
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// whether u is within the host and path limits
+func (m *mirror) follow(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if !m.hostAllowed(u.Hostname()) {
+		return false
+	}
+	return len(m.option.PathPrefix) == 0 || strings.HasPrefix(u.Path, m.option.PathPrefix)
+}
+
+func (m *mirror) hostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	if host == strings.ToLower(m.start.Hostname()) {
+		return true
+	}
+	for _, domain := range m.option.Domains {
+		domain = strings.ToLower(domain)
+		if strings.HasPrefix(domain, "*.") {
+			if strings.HasSuffix(host, domain[1:]) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// dir/host/path. "index.html" is used for a directory, the query is appended after "@",
+// and ".html" is appended to the HTML without an extension of HTML.
+func (m *mirror) localPath(u *url.URL, isHTML bool) string {
+	p := u.Path
+	if len(p) == 0 || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	if len(u.RawQuery) > 0 {
+		p += "@" + strings.Replace(u.RawQuery, "/", "%2F", -1)
+	}
+	if isHTML {
+		if ext := strings.ToLower(path.Ext(p)); ext != ".html" && ext != ".htm" {
+			p += ".html"
+		}
+	}
+	return filepath.Join(m.dir, hostDir(u), filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// directory name of the host of u, the port is appended as "host_port" only if it is not
+// the default one of the scheme. the colons of IPv6 are replaced as they are not safe in paths.
+func hostDir(u *url.URL) string {
+	host := strings.Replace(u.Hostname(), ":", "_", -1)
+	switch port := u.Port(); {
+	case len(port) == 0:
+	case port == "80" && u.Scheme == "http", port == "443" && u.Scheme == "https":
+	default:
+		host += "_" + port
+	}
+	return host
+}
+
+// links to the saved files are made relative to the local files, the other ones are made absolute.
+func (m *mirror) convertLinks() {
+	for _, doc := range m.docs {
+		content, err := ioutil.ReadFile(doc.localPath)
+		if err != nil {
+			m.logf("convert links of %s: %v\n", doc.localPath, err)
+			continue
+		}
+		converted := rewriteLinks(string(content), doc.isHTML, func(link string) string {
+			ref := resolveLink(doc.u, link)
+			if ref == nil {
+				return link
+			}
+			target, ok := m.saved[ref.String()]
+			if !ok {
+				abs := *ref
+				abs.Fragment = fragmentOf(link)
+				return abs.String()
+			}
+			rel, err := filepath.Rel(filepath.Dir(doc.localPath), target)
+			if err != nil {
+				return link
+			}
+			relURL := &url.URL{Path: filepath.ToSlash(rel), Fragment: fragmentOf(link)}
+			return relURL.String()
+		})
+		if converted != string(content) {
+			if err = ioutil.WriteFile(doc.localPath, []byte(converted), 0644); err != nil {
+				m.logf("convert links of %s: %v\n", doc.localPath, err)
+			}
+		}
+	}
+}
+
+func (m *mirror) logf(format string, args ...interface{}) {
+	if m.option.Logger != nil {
+		fmt.Fprintf(m.option.Logger, format, args...)
+	}
+}
+
+// absolute url of link without fragment, nil if it is not a link to be followed
+func resolveLink(base *url.URL, link string) *url.URL {
+	link = strings.TrimSpace(link)
+	if len(link) == 0 || strings.HasPrefix(link, "#") {
+		return nil
+	}
+	ref, err := base.Parse(link)
+	if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+		return nil
+	}
+	ref.Fragment = ""
+	return ref
+}
+
+func fragmentOf(link string) string {
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		return link[i+1:]
+	}
+	return ""
+}
+
+// call fn with every link in content of HTML or CSS, and replace the link with what fn returns
+func rewriteLinks(content string, isHTML bool, fn func(link string) string) string {
+	if isHTML {
+		content = replaceSubmatches(content, htmlLinkRegexp, true, func(attr, value string) string {
+			if strings.EqualFold(attr, "srcset") {
+				return html.EscapeString(rewriteSrcset(html.UnescapeString(value), fn))
+			}
+			link := html.UnescapeString(value)
+			if newLink := fn(link); newLink != link {
+				return html.EscapeString(newLink)
+			}
+			return value
+		})
+	}
+	// url() in CSS, or in <style> and style attributes of HTML
+	return replaceSubmatches(content, cssLinkRegexp, false, func(_, value string) string {
+		return fn(value)
+	})
+}
+
+// "a.png 1x, b.png 2x"
+func rewriteSrcset(srcset string, fn func(link string) string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = fn(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// the first submatch is taken as the name if named is true, and the first matched one of the
+// other submatches as the value, which is replaced with what fn returns.
+func replaceSubmatches(content string, re *regexp.Regexp, named bool, fn func(name, value string) string) string {
+	matches := re.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		var name string
+		first := 1
+		if named {
+			name = content[match[2]:match[3]]
+			first = 2
+		}
+		for g := first; g <= re.NumSubexp(); g++ {
+			start, end := match[2*g], match[2*g+1]
+			if start < 0 {
+				continue
+			}
+			b.WriteString(content[last:start])
+			b.WriteString(fn(name, content[start:end]))
+			last = end
+			break
+		}
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package wget
 
 import (
+	"context"
 	wr "github.com/mroth/weightedrand"
 	// "path"
 	"fmt"
@@ -14,6 +15,7 @@ type baseItem struct {
 	baseUrl string
 	weight  uint
 	lastAccessTime int64
+	limiter *RateLimiter
 }
 
 func BaseItem(baseUrl string, weight ...uint) baseItem {
@@ -36,6 +38,7 @@ type BaseUrl struct {
 	chooser *wr.Chooser
 	rd *rand.Rand
 	lastOKIndex int
+	middlewares []Middleware
 }
 
 func NewBaseUrl(baseItem ...baseItem) (b *BaseUrl, err error) {
@@ -57,54 +60,110 @@ func NewBaseUrl(baseItem ...baseItem) (b *BaseUrl, err error) {
 	return
 }
 
+// same as NewBaseUrl, with weights[i] as the weight of baseUrls[i]. no weight is given if weights is nil.
+func NewWeightedBaseUrl(baseUrls []string, weights []uint) (*BaseUrl, error) {
+	if weights != nil && len(weights) != len(baseUrls) {
+		return nil, fmt.Errorf("%d weights for %d base urls", len(weights), len(baseUrls))
+	}
+	items := make([]baseItem, len(baseUrls))
+	for i, baseUrl := range baseUrls {
+		if weights == nil {
+			items[i] = BaseItem(baseUrl)
+		} else {
+			items[i] = BaseItem(baseUrl, weights[i])
+		}
+	}
+	return NewBaseUrl(items...)
+}
+
 func (b *BaseUrl) HttpCall(uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.HttpCallContext(context.Background(), uri, method, params, header, options...)
+}
+
+func (b *BaseUrl) HttpCallContext(ctx context.Context, uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.httpCall(ctx, uri, method, params, toHttpHeader(header), options...)
+}
+
+func (b *BaseUrl) httpCall(ctx context.Context, uri, method string, params interface{}, header http.Header, options ...Options) (status int, content []byte, resp *http.Response, err error) {
 	if isHttpUrl(uri) {
-		return newRequest(uri, 0, options...).Run(uri, method, params, header)
+		return b.newRequest(uri, options...).runHttp(ctx, uri, method, params, header)
 	}
 
 	var paramsReader io.ReadSeeker
-	if uri, method, paramsReader, header, err = adjustHttpArgs(uri, method, params, header); err != nil {
+	if uri, method, paramsReader, header, err = adjustHttpArgs(uri, method, params, header, firstOption(options)); err != nil {
 		return
 	}
 
-	return b.run(uri, method, paramsReader, header, options...)
+	return b.run(ctx, uri, method, paramsReader, header, options...)
 }
 
 func (b *BaseUrl) JsonCall(uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.JsonCallContext(context.Background(), uri, method, params, header, options...)
+}
+
+func (b *BaseUrl) JsonCallContext(ctx context.Context, uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.jsonCall(ctx, uri, method, params, toHttpHeader(header), options...)
+}
+
+func (b *BaseUrl) jsonCall(ctx context.Context, uri, method string, params interface{}, header http.Header, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.codecCall(ctx, uri, method, params, header, JsonCodec, options...)
+}
+
+func (b *BaseUrl) XmlCall(uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.XmlCallContext(context.Background(), uri, method, params, header, options...)
+}
+
+func (b *BaseUrl) XmlCallContext(ctx context.Context, uri, method string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.xmlCall(ctx, uri, method, params, toHttpHeader(header), options...)
+}
+
+func (b *BaseUrl) xmlCall(ctx context.Context, uri, method string, params interface{}, header http.Header, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.codecCall(ctx, uri, method, params, header, XmlCodec, options...)
+}
+
+func (b *BaseUrl) codecCall(ctx context.Context, uri, method string, params interface{}, header http.Header, codec Codec, options ...Options) (status int, content []byte, resp *http.Response, err error) {
 	if isHttpUrl(uri) {
-		return newRequest(uri, 0, options...).PostJson(uri, method, params, header)
+		return b.newRequest(uri, options...).runCodec(ctx, uri, method, params, header, codec)
 	}
 
 	var paramsReader io.ReadSeeker
-	if method, paramsReader, header, err = adjustJsonArgs(method, params, header); err != nil {
+	if method, paramsReader, header, err = adjustCodecArgs(method, params, header, codec); err != nil {
 		return
 	}
 
-	return b.run(uri, method, paramsReader, header, options...)
+	return b.run(ctx, uri, method, paramsReader, header, options...)
 }
 
 func (b *BaseUrl) GetWithBody(uri string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.GetWithBodyContext(context.Background(), uri, params, header, options...)
+}
+
+func (b *BaseUrl) GetWithBodyContext(ctx context.Context, uri string, params interface{}, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+	return b.getWithBody(ctx, uri, params, toHttpHeader(header), options...)
+}
+
+func (b *BaseUrl) getWithBody(ctx context.Context, uri string, params interface{}, header http.Header, options ...Options) (status int, content []byte, resp *http.Response, err error) {
 	if isHttpUrl(uri) {
-		return newRequest(uri, 0, options...).GetUsingBodyParams(uri, params, header)
+		return b.newRequest(uri, options...).runGetWithBody(ctx, uri, params, header)
 	}
 
 	var paramsReader io.ReadSeeker
-	if _, _, paramsReader, header, err = adjustHttpArgs(uri, http.MethodPost, params, header); err != nil {
+	if _, _, paramsReader, header, err = adjustHttpArgs(uri, http.MethodPost, params, header, firstOption(options)); err != nil {
 		return
 	}
 
-	return b.run(uri, http.MethodGet, paramsReader, header, options...)
+	return b.run(ctx, uri, http.MethodGet, paramsReader, header, options...)
 }
 
-func (b *BaseUrl) run(uri, method string, paramsReader io.ReadSeeker, header map[string]string, options ...Options) (status int, content []byte, resp *http.Response, err error) {
+func (b *BaseUrl) run(ctx context.Context, uri, method string, paramsReader io.ReadSeeker, header http.Header, options ...Options) (status int, content []byte, resp *http.Response, err error) {
 	startIdx := b.pick()
 	for i:=startIdx; i<len(b.baseItems); i++ {
 		url := fmt.Sprintf("%s%s", b.baseItems[i].baseUrl, uri)
 		if paramsReader != nil {
 			paramsReader.Seek(0, io.SeekStart)
 		}
-		status, content, resp, err = newRequest(url, 0, options...).run(url, method, paramsReader, header)
-		if err == nil {
+		status, content, resp, err = b.newItemRequest(i, url, options...).run(ctx, url, method, paramsReader, header)
+		if err == nil || ctx.Err() != nil || !shouldFailover(err) {
 			return
 		}
 	}
@@ -113,8 +172,8 @@ func (b *BaseUrl) run(uri, method string, paramsReader io.ReadSeeker, header map
 		if paramsReader != nil {
 			paramsReader.Seek(0, io.SeekStart)
 		}
-		status, content, resp, err = newRequest(url, 0, options...).run(url, method, paramsReader, header)
-		if err == nil {
+		status, content, resp, err = b.newItemRequest(i, url, options...).run(ctx, url, method, paramsReader, header)
+		if err == nil || ctx.Err() != nil || !shouldFailover(err) {
 			return
 		}
 	}
@@ -122,6 +181,31 @@ func (b *BaseUrl) run(uri, method string, paramsReader io.ReadSeeker, header map
 	return
 }
 
+func (b *BaseUrl) newRequest(url string, options ...Options) *Request {
+	wget := newRequest(url, 0, options...)
+	wget.middlewares = b.middlewares
+	return wget
+}
+
+// request to the i-th item, limited by its rate limiter
+func (b *BaseUrl) newItemRequest(i int, url string, options ...Options) *Request {
+	wget := b.newRequest(url, options...)
+	wget.limiter = b.baseItems[i].limiter
+	return wget
+}
+
+// limiter applied to requests to the item of baseUrl, nil to remove it. it should be set before
+// b is used. ErrRateLimited got with Options.RateLimitNoWait makes b fail over to the next item.
+func (b *BaseUrl) SetRateLimiter(baseUrl string, limiter *RateLimiter) error {
+	for i := range b.baseItems {
+		if b.baseItems[i].baseUrl == baseUrl {
+			b.baseItems[i].limiter = limiter
+			return nil
+		}
+	}
+	return fmt.Errorf("base URL %s not found", baseUrl)
+}
+
 func (b *BaseUrl) pick() int {
 	return b.chooser.PickSource(b.rd).(int)
 }
@@ -167,5 +251,4 @@ func (b *BaseUrl) createRandChooser() {
 
 	b.rd = rand.New(rand.NewSource(time.Now().UnixNano()))
 	b.chooser, _ = wr.NewChooser(choices...)
-	fmt.Printf("b: %#v\n", b)
 }
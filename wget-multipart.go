@@ -0,0 +1,207 @@
+package wget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// params of multipart/form-data, which can be used as params of Wget, BaseUrl.HttpCall or Args.Params.
+// the body is streamed through an io.Pipe, files are opened only when they are being sent.
+// it can be rewound with Seek(0, io.SeekStart) for retrying, as long as all the readers added are io.Seeker.
+// Close stops the streaming, it is called by the http client when the request is done.
+type Multipart struct {
+	parts    []*multipartPart
+	boundary string
+
+	mu      sync.Mutex
+	pr      *io.PipeReader
+	done    chan struct{} // closed when the writing goroutine exits
+	started bool
+}
+
+type multipartPart struct {
+	fieldName   string
+	fileName    string
+	contentType string
+	value       string
+	filePath    string
+	reader      io.Reader
+	isFile      bool
+}
+
+var (
+	errMultipartRewound = errors.New("multipart body rewound")
+	errMultipartClosed  = errors.New("multipart body closed")
+	quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+)
+
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+// add a text field. the optional contentType is sent as Content-Type of the part
+func (m *Multipart) AddField(name, value string, contentType ...string) *Multipart {
+	m.parts = append(m.parts, &multipartPart{fieldName: name, value: value, contentType: firstString(contentType)})
+	return m
+}
+
+// add a file part. the file name sent is the base name of filePath,
+// and the content type is guessed from its extension if contentType is not given.
+func (m *Multipart) AddFile(fieldName, filePath string, contentType ...string) *Multipart {
+	m.parts = append(m.parts, &multipartPart{
+		fieldName: fieldName,
+		fileName: filepath.Base(filePath),
+		contentType: firstString(contentType),
+		filePath: filePath,
+		isFile: true,
+	})
+	return m
+}
+
+// add a file part with content read from r.
+func (m *Multipart) AddReader(fieldName, fileName string, r io.Reader, contentType ...string) *Multipart {
+	m.parts = append(m.parts, &multipartPart{
+		fieldName: fieldName,
+		fileName: fileName,
+		contentType: firstString(contentType),
+		reader: r,
+		isFile: true,
+	})
+	return m
+}
+
+// value of Content-Type header including the boundary
+func (m *Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// ---- implementation of io.ReadSeeker and io.Closer ----
+func (m *Multipart) Read(p []byte) (int, error) {
+	m.mu.Lock()
+	if m.pr == nil {
+		m.start()
+	}
+	pr := m.pr
+	m.mu.Unlock()
+	return pr.Read(p)
+}
+
+// only Seek(0, io.SeekStart) is supported, which restarts the body.
+func (m *Multipart) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, fmt.Errorf("multipart body can only be rewound to the start")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.started {
+		return 0, nil
+	}
+	if m.pr != nil {
+		m.pr.CloseWithError(errMultipartRewound)
+		// the readers of parts may be still used by the writing goroutine
+		<-m.done
+		m.pr = nil
+	}
+	for _, part := range m.parts {
+		if part.reader == nil {
+			continue
+		}
+		seeker, ok := part.reader.(io.Seeker)
+		if !ok {
+			return 0, fmt.Errorf("reader of part %s can not be rewound", part.fieldName)
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// the writing goroutine exits and the file being sent is closed. it can be restarted by Seek(0, io.SeekStart).
+func (m *Multipart) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pr != nil {
+		m.pr.CloseWithError(errMultipartClosed)
+	}
+	return nil
+}
+
+func (m *Multipart) start() {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	m.pr, m.done, m.started = pr, done, true
+
+	mw := multipart.NewWriter(pw)
+	mw.SetBoundary(m.boundary)
+	go func() {
+		pw.CloseWithError(m.writeParts(mw))
+		close(done)
+	}()
+}
+
+func (m *Multipart) writeParts(mw *multipart.Writer) error {
+	for _, part := range m.parts {
+		if err := part.write(mw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (part *multipartPart) write(mw *multipart.Writer) error {
+	h := make(textproto.MIMEHeader)
+	if !part.isFile {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(part.fieldName)))
+		if len(part.contentType) > 0 {
+			h.Set("Content-Type", part.contentType)
+		}
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, part.value)
+		return err
+	}
+
+	r := part.reader
+	if r == nil {
+		fp, err := os.Open(part.filePath)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		r = fp
+	}
+
+	contentType := part.contentType
+	if len(contentType) == 0 {
+		if contentType = mime.TypeByExtension(filepath.Ext(part.fileName)); len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+	}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(part.fieldName), quoteEscaper.Replace(part.fileName)))
+	h.Set("Content-Type", contentType)
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func firstString(s []string) string {
+	if len(s) > 0 {
+		return s[0]
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package wget
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// a key-value pair of OrderedParams
+type Param struct {
+	Key   string
+	Value interface{}
+}
+
+// params encoded in the order they are added, rather than sorted by key like url.Values.
+// it can be used as params of Wget, BaseUrl.HttpCall or Args.Params.
+type OrderedParams []Param
+
+// called with the encoded query string or form body, the returned one is sent instead.
+// it is used to append a signature, e.g.:
+//   func(encoded string) (string, error) { return encoded + "&sign=" + sign(encoded), nil }
+type ParamsHook func(encoded string) (string, error)
+
+func NewOrderedParams() OrderedParams {
+	return OrderedParams{}
+}
+
+func (p OrderedParams) Add(key string, value interface{}) OrderedParams {
+	return append(p, Param{Key: key, Value: value})
+}
+
+func (p OrderedParams) Encode(style NestedStyle) (string, error) {
+	b := &strings.Builder{}
+	for _, param := range p {
+		values := url.Values{}
+		if err := encodeFormValue(values, param.Key, reflect.ValueOf(param.Value), "", style); err != nil {
+			return "", err
+		}
+		// all values of a key are kept in order, while nested keys of a value are sorted
+		encoded := values.Encode()
+		if len(encoded) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(encoded)
+	}
+	return b.String(), nil
+}
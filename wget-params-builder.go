@@ -1,28 +1,32 @@
 package wget
 
 import (
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"fmt"
 	"io"
 	"bytes"
+	"io/ioutil"
 	"strings"
-	"encoding/json"
 )
 
-func buildHttpParams(params interface{}) (io.ReadSeeker, error) {
-	if params == nil {
+func buildHttpParams(params interface{}, style NestedStyle, hook ParamsHook) (io.ReadSeeker, error) {
+	if params == nil && hook == nil {
 		return nil, nil
 	}
 	switch v := params.(type) {
 	case io.ReadSeeker:
 		return v, nil
 	default:
-		param, err := buildHttpStringParams(params)
+		param, err := buildHttpStringParams(params, style)
 		if err != nil {
 			return nil, err
 		}
+		if hook != nil {
+			if param, err = hook(param); err != nil {
+				return nil, err
+			}
+		}
 		if len(param) == 0 {
 			return nil, nil
 		}
@@ -30,11 +34,13 @@ func buildHttpParams(params interface{}) (io.ReadSeeker, error) {
 	}
 }
 
-func buildHttpStringParams(params interface{}) (string, error) {
+func buildHttpStringParams(params interface{}, style NestedStyle) (string, error) {
 	if params == nil {
 		return "", nil
 	}
 	switch v := params.(type) {
+	case *Multipart:
+		return "", fmt.Errorf("multipart params can only be sent as body")
 	case *strings.Builder:
 		return v.String(), nil
 	case *bytes.Buffer:
@@ -52,12 +58,12 @@ func buildHttpStringParams(params interface{}) (string, error) {
 		return string(v), nil
 	case string:
 		return v, nil
-	case map[string]interface{}:
-		u := url.Values{}
-		for k, vv := range v {
-			u.Set(k, fmt.Sprintf("%v", vv))
-		}
-		return u.Encode(), nil
+	case url.Values:
+		return v.Encode(), nil
+	case map[string][]string:
+		return url.Values(v).Encode(), nil
+	case OrderedParams:
+		return v.Encode(style)
 	case map[string]string:
 		u := url.Values{}
 		for k, vv := range v {
@@ -70,48 +76,22 @@ func buildHttpStringParams(params interface{}) (string, error) {
 		bool:
 		return fmt.Sprintf("%v", v), nil
 	default:
-		return "", fmt.Errorf("unknown type to build http params")
-	}
-}
-
-func buildJsonParams(params interface{}) (io.ReadSeeker, error) {
-	if params == nil {
-		return strings.NewReader("null"), nil
-	}
-
-	switch v := params.(type) {
-	case io.ReadSeeker:
-		return v, nil
-	case *strings.Builder:
-		return strings.NewReader(v.String()), nil
-	case *bytes.Buffer:
-		return bytes.NewReader(v.Bytes()), nil
-	case io.WriterTo:
-		b := &bytes.Buffer{}
-		if _, err := v.WriteTo(b); err != nil {
-			return nil, err
-		}
-		return bytes.NewReader(b.Bytes()), nil
-	case io.Reader:
-		p, err := ioutil.ReadAll(v)
+		// map[string]interface{}, struct etc.
+		u, err := encodeForm(params, style)
 		if err != nil {
-			return nil, err
-		}
-		return bytes.NewReader(p), nil
-	case []byte:
-		return bytes.NewReader(v), nil
-	default:
-		buf := &bytes.Buffer{}
-		jsonEncoder := json.NewEncoder(buf)
-		jsonEncoder.SetEscapeHTML(false)
-		if err := jsonEncoder.Encode(params); err != nil {
-			return nil, err
+			return "", err
 		}
-		return bytes.NewReader(buf.Bytes()), nil
+		return u.Encode(), nil
 	}
 }
 
-func adjustHttpArgs(url, method string, params interface{}, header map[string]string) (string, string, io.ReadSeeker, map[string]string, error) {
+func adjustHttpArgs(url, method string, params interface{}, header http.Header, option *Options) (string, string, io.ReadSeeker, http.Header, error) {
+	var style NestedStyle
+	var hook ParamsHook
+	if option != nil {
+		style, hook = option.NestedStyle, option.ParamsHook
+	}
+
 	if len(method) == 0 {
 		method = http.MethodGet
 	} else {
@@ -120,12 +100,18 @@ func adjustHttpArgs(url, method string, params interface{}, header map[string]st
 
 	var paramsReader io.ReadSeeker
 
-	switch method {
-	case http.MethodGet, http.MethodHead:
-		p, err := buildHttpStringParams(params)
+	paramsIn, _ := methodParamsIn(method)
+	switch paramsIn {
+	case ParamsInQuery:
+		p, err := buildHttpStringParams(params, style)
 		if err != nil {
 			return url, method, paramsReader, header, err
 		}
+		if hook != nil {
+			if p, err = hook(p); err != nil {
+				return url, method, paramsReader, header, err
+			}
+		}
 		if len(p) > 0 {
 			deli := '?'
 			if strings.Contains(url, "?") {
@@ -134,22 +120,23 @@ func adjustHttpArgs(url, method string, params interface{}, header map[string]st
 			url = fmt.Sprintf("%s%c%s", url, deli, p)
 		}
 	default:
-		p, err := buildHttpParams(params)
+		p, err := buildHttpParams(params, style, hook)
 		if err != nil {
 			return url, method, paramsReader, header, err
 		}
 
 		paramsReader = p
-		if header == nil {
-			header = make(map[string]string, 1)
+		if m, ok := params.(*Multipart); ok {
+			header = setContentType(header, m.ContentType())
+		} else {
+			header = setContentType(header, "application/x-www-form-urlencoded")
 		}
-		header["Content-Type"] = "application/x-www-form-urlencoded"
 	}
 	return url, method, paramsReader, header, nil
 }
 
-func adjustJsonArgs(method string, params interface{}, header map[string]string) (string, io.ReadSeeker, map[string]string, error) {
-	j, err := buildJsonParams(params)
+func adjustCodecArgs(method string, params interface{}, header http.Header, codec Codec) (string, io.ReadSeeker, http.Header, error) {
+	body, err := buildCodecParams(codec, params)
 	if err != nil {
 		return method, nil, header, err
 	}
@@ -160,10 +147,17 @@ func adjustJsonArgs(method string, params interface{}, header map[string]string)
 		method = strings.ToUpper(method)
 	}
 
+	header = setContentType(header, codec.ContentType())
+	return method, body, header, nil
+}
+
+// the header given by caller is kept untouched
+func setContentType(header http.Header, contentType string) http.Header {
 	if header == nil {
-		header = make(map[string]string, 1)
+		header = make(http.Header, 1)
+	} else {
+		header = header.Clone()
 	}
-	header["Content-Type"] = "application/json"
-	return method, j, header, nil
+	header.Set("Content-Type", contentType)
+	return header
 }
-
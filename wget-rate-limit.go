@@ -0,0 +1,236 @@
+package wget
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// returned instead of waiting for a token if Options.RateLimitNoWait is set
+var ErrRateLimited = errors.New("rate limited")
+
+// a token bucket limiting the requests. it can be set globally by SetGlobalRateLimiter(),
+// per host by SetHostRateLimiter(), or per item of BaseUrl by BaseUrl.SetRateLimiter().
+type RateLimiter struct {
+	// adapt to the response headers: wait until Retry-After of 429/503, or X-RateLimit-Reset
+	// if X-RateLimit-Remaining is 0, and slow down to X-RateLimit-Remaining per the seconds to reset.
+	Adaptive bool
+
+	mu     sync.Mutex
+	qps    float64 // configured rate
+	rate   float64 // current rate, may be lowered by adaption
+	burst  float64
+	tokens float64
+	last   time.Time // when tokens is computed, may be in future if it is blocked by adaption
+}
+
+// qps tokens are added per second, at most burst tokens are kept. burst is 1 if it is less than 1.
+func NewRateLimiter(qps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{qps: qps, rate: qps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait for a token until ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	return waitLimiters(ctx, false, l)
+}
+
+// take a token if there's one available now
+func (l *RateLimiter) Allow() bool {
+	return waitLimiters(context.Background(), true, l) == nil
+}
+
+// take a token, and return the time to wait for it
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	l.tokens -= 1
+	ready := l.last
+	if l.tokens < 0 {
+		if l.rate <= 0 {
+			return time.Duration(math.MaxInt64)
+		}
+		ready = ready.Add(time.Duration(-l.tokens / l.rate * float64(time.Second)))
+	}
+	return ready.Sub(now)
+}
+
+// give back a reserved token
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens += 1; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+func (l *RateLimiter) advance(now time.Time) {
+	if !now.After(l.last) {
+		return
+	}
+	if l.tokens += now.Sub(l.last).Seconds() * l.rate; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+func (l *RateLimiter) adapt(resp *http.Response) {
+	now := time.Now()
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := retryAfter(resp); ok {
+			until = now.Add(d)
+		}
+	}
+	remaining, hasRemaining := rateLimitHeader(resp.Header, "Remaining")
+	reset, hasReset := rateLimitHeader(resp.Header, "Reset")
+	var resetTime time.Time
+	if hasReset {
+		if reset > 1e9 {
+			// epoch seconds
+			resetTime = time.Unix(reset, 0)
+		} else {
+			resetTime = now.Add(time.Duration(reset) * time.Second)
+		}
+	}
+	if hasRemaining && remaining <= 0 && resetTime.After(until) {
+		until = resetTime
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	l.rate = l.qps
+	if hasRemaining && remaining > 0 && resetTime.After(now) {
+		if rate := float64(remaining) / resetTime.Sub(now).Seconds(); rate < l.rate {
+			l.rate = rate
+		}
+	}
+	if until.After(l.last) {
+		// no token until then
+		if l.tokens > 0 {
+			l.tokens = 0
+		}
+		l.last = until
+	}
+}
+
+// X-RateLimit-<name> or RateLimit-<name>
+func rateLimitHeader(header http.Header, name string) (int64, bool) {
+	v := header.Get("X-RateLimit-" + name)
+	if len(v) == 0 {
+		v = header.Get("RateLimit-" + name)
+	}
+	if len(v) == 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n, err == nil
+}
+
+// take a token from every limiter, waiting until all of them are available
+func waitLimiters(ctx context.Context, noWait bool, limiters ...*RateLimiter) error {
+	now := time.Now()
+	var wait time.Duration
+	reserved := make([]*RateLimiter, 0, len(limiters))
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		if d := l.reserve(now); d > wait {
+			wait = d
+		}
+		reserved = append(reserved, l)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	err := ErrRateLimited
+	if !noWait {
+		if err = sleepContext(ctx, wait); err == nil {
+			return nil
+		}
+	}
+	for _, l := range reserved {
+		l.cancel()
+	}
+	return err
+}
+
+var rateLimiters = struct {
+	sync.RWMutex
+	global *RateLimiter
+	hosts  map[string]*RateLimiter
+}{
+	hosts: map[string]*RateLimiter{},
+}
+
+// limiter applied to all requests, nil to remove it
+func SetGlobalRateLimiter(limiter *RateLimiter) {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	rateLimiters.global = limiter
+}
+
+// limiter applied to requests to host, which is a host name, or "host:port" for the port only.
+// nil to remove it
+func SetHostRateLimiter(host string, limiter *RateLimiter) {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	host = strings.ToLower(host)
+	if limiter == nil {
+		delete(rateLimiters.hosts, host)
+	} else {
+		rateLimiters.hosts[host] = limiter
+	}
+}
+
+func hostRateLimiters(u *url.URL) (host, global *RateLimiter) {
+	rateLimiters.RLock()
+	defer rateLimiters.RUnlock()
+	if len(rateLimiters.hosts) > 0 {
+		var ok bool
+		if host, ok = rateLimiters.hosts[strings.ToLower(u.Host)]; !ok {
+			host = rateLimiters.hosts[strings.ToLower(u.Hostname())]
+		}
+	}
+	return host, rateLimiters.global
+}
+
+// the most specific limiter adapts to the response if it is Adaptive
+func rateLimitMiddleware(itemLimiter *RateLimiter, noWait bool) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			hostLimiter, globalLimiter := hostRateLimiters(req.URL)
+			if itemLimiter == nil && hostLimiter == nil && globalLimiter == nil {
+				return next(req)
+			}
+			if err := waitLimiters(req.Context(), noWait, itemLimiter, hostLimiter, globalLimiter); err != nil {
+				return nil, err
+			}
+
+			resp, err := next(req)
+			if resp != nil {
+				for _, l := range []*RateLimiter{itemLimiter, hostLimiter, globalLimiter} {
+					if l != nil {
+						if l.Adaptive {
+							l.adapt(resp)
+						}
+						break
+					}
+				}
+			}
+			return resp, err
+		}
+	}
+}
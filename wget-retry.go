@@ -0,0 +1,149 @@
+package wget
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retry policy used by Request.run, set it with Options.Retry or Args.Retry
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first one, retry is disabled if it is less than 2
+	BaseDelay   time.Duration // delay before the 2nd attempt, doubled for every further attempt. default_retry_delay if 0
+	MaxDelay    time.Duration // upper bound of the backoff delay, no bound if 0. a longer Retry-After is not waited for
+	RetryStatus []int         // status codes to retry, DefaultRetryStatus is used if it is empty
+
+	// requests of methods which are not safe, e.g. POST/PUT/PATCH/DELETE, may have been processed by the server
+	// if the connection is broken or times out after they are sent, so they are retried only on the errors
+	// before sending (DNS, connection refused, dial failures) or on RetryStatus, unless it is true.
+	RetryNonIdempotent bool
+}
+
+var DefaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+const (
+	default_retry_delay     = 100 * time.Millisecond
+	default_max_retry_after = time.Minute // longest Retry-After waited for if MaxDelay is 0
+)
+
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: maxAttempts}
+}
+
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) shouldRetry(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		if !IsRetryable(err) {
+			return false
+		}
+		return p.RetryNonIdempotent || safeMethod(method) || notSent(err)
+	}
+	if d, ok := retryAfter(resp); ok && d > p.maxRetryAfter() {
+		// give up instead of blocking too long
+		return false
+	}
+	retryStatus := p.RetryStatus
+	if len(retryStatus) == 0 {
+		retryStatus = DefaultRetryStatus
+	}
+	for _, status := range retryStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return default_max_retry_after
+}
+
+// delay before the next attempt. attempt is the number of attempts done.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		return d
+	}
+
+	d := p.BaseDelay
+	if d <= 0 {
+		d = default_retry_delay
+	}
+	for i:=1; i<attempt; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	// equal jitter: half of the delay is fixed, the other half is random
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// value of header Retry-After, either delay-seconds or HTTP-date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if len(v) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// drain and close the body of a response to be retried, so the connection can be reused
+func discardResp(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
+
+// sleep for d, or return the error of ctx if it is done before that
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
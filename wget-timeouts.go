@@ -0,0 +1,69 @@
+package wget
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// fine-grained timeouts, a zero value means the default one.
+type Timeouts struct {
+	Dial           time.Duration // to establish a connection, connect_timeout seconds by default
+	TLSHandshake   time.Duration // to finish the TLS handshake, tls_handshake_timeout by default
+	ResponseHeader time.Duration // to get the response headers after the request is sent, no limit by default
+	IdleRead       time.Duration // between two reads of the response body, no limit by default
+	Overall        time.Duration // of the whole request including reading body. Options.Timeout is used if it is 0
+}
+
+// error returned while reading a response body which is idle longer than Timeouts.IdleRead
+type idleTimeoutError struct{}
+
+func (idleTimeoutError) Error() string   { return "idle timeout while reading response body" }
+func (idleTimeoutError) Timeout() bool   { return true }
+func (idleTimeoutError) Temporary() bool { return true }
+
+// the request is cancelled if no data is read from body within timeout
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout, cancel: cancel}
+	b.timer = time.AfterFunc(timeout, b.expire)
+	return b
+}
+
+func (b *idleTimeoutBody) expire() {
+	b.mu.Lock()
+	b.timedOut = true
+	b.mu.Unlock()
+	b.cancel()
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.mu.Lock()
+	timedOut := b.timedOut
+	b.mu.Unlock()
+	if timedOut {
+		return n, idleTimeoutError{}
+	}
+	if err == nil {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
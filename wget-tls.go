@@ -0,0 +1,91 @@
+package wget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// TLS settings of https requests. server certificates are verified unless InsecureSkipVerify is set.
+type TLSOptions struct {
+	CAFile   string // PEM bundle of CAs to verify server certificates, system roots are used if it is empty
+	CertFile string // PEM file of the client certificate
+	KeyFile  string // PEM file of the client private key
+
+	InsecureSkipVerify bool     // accept any server certificate, for testing only
+	MinVersion   uint16         // tls.VersionTLS12 if it is 0
+	CipherSuites []uint16       // cipher suites for TLS 1.2 and below, Go defaults if it is empty
+	ServerName   string         // SNI and name to verify, the host of url if it is empty
+}
+
+// comparable form of TLSOptions used in transportKey
+type tlsKey struct {
+	caFile       string
+	certFile     string
+	keyFile      string
+	insecure     bool
+	minVersion   uint16
+	cipherSuites string
+	serverName   string
+}
+
+func newTLSKey(option *TLSOptions) tlsKey {
+	if option == nil {
+		return tlsKey{}
+	}
+	suites := make([]string, len(option.CipherSuites))
+	for i, suite := range option.CipherSuites {
+		suites[i] = strconv.Itoa(int(suite))
+	}
+	return tlsKey{
+		caFile: option.CAFile,
+		certFile: option.CertFile,
+		keyFile: option.KeyFile,
+		insecure: option.InsecureSkipVerify,
+		minVersion: option.MinVersion,
+		cipherSuites: strings.Join(suites, ","),
+		serverName: option.ServerName,
+	}
+}
+
+func (key tlsKey) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: key.minVersion,
+		ServerName: key.serverName,
+		InsecureSkipVerify: key.insecure,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if len(key.cipherSuites) > 0 {
+		for _, s := range strings.Split(key.cipherSuites, ",") {
+			suite, _ := strconv.Atoi(s)
+			config.CipherSuites = append(config.CipherSuites, uint16(suite))
+		}
+	}
+
+	if len(key.caFile) > 0 {
+		caBytes, err := ioutil.ReadFile(key.caFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", key.caFile)
+		}
+		config.RootCAs = rootCAs
+	}
+
+	if len(key.certFile) > 0 || len(key.keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(key.certFile, key.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
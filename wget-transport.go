@@ -0,0 +1,143 @@
+package wget
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// settings that make a transport different from others.
+// transports with the same key are shared, so keep-alive connections can be reused.
+type transportKey struct {
+	tls tlsKey
+
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+
+	proxy        string
+	proxyFromEnv bool
+
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+const (
+	default_max_idle_conns          = 100
+	default_max_idle_conns_per_host = 16
+	idle_conn_timeout   = 90 * time.Second
+	dial_keep_alive     = 30 * time.Second
+	tls_handshake_timeout = 10 * time.Second
+)
+
+var transportPool = struct {
+	sync.Mutex
+	transports map[transportKey]*http.Transport
+}{transports: make(map[transportKey]*http.Transport)}
+
+func newTransportKey(timeouts Timeouts, option *Options) transportKey {
+	key := transportKey{
+		maxIdleConns: default_max_idle_conns,
+		maxIdleConnsPerHost: default_max_idle_conns_per_host,
+		dialTimeout: timeouts.Dial,
+		tlsHandshakeTimeout: timeouts.TLSHandshake,
+		responseHeaderTimeout: timeouts.ResponseHeader,
+	}
+	if option == nil {
+		return key
+	}
+	if option.MaxIdleConns > 0 {
+		key.maxIdleConns = option.MaxIdleConns
+	}
+	if option.MaxIdleConnsPerHost > 0 {
+		key.maxIdleConnsPerHost = option.MaxIdleConnsPerHost
+	}
+	if option.MaxConnsPerHost > 0 {
+		key.maxConnsPerHost = option.MaxConnsPerHost
+	}
+	key.tls = newTLSKey(option.TLS)
+	key.proxy = option.Proxy
+	key.proxyFromEnv = option.ProxyFromEnv
+	return key
+}
+
+func getTransport(key transportKey) (*http.Transport, error) {
+	transportPool.Lock()
+	defer transportPool.Unlock()
+
+	if transport, ok := transportPool.transports[key]; ok {
+		return transport, nil
+	}
+
+	transport, err := newTransport(key)
+	if err != nil {
+		return nil, err
+	}
+	transportPool.transports[key] = transport
+	return transport, nil
+}
+
+func newTransport(key transportKey) (*http.Transport, error) {
+	proxy, err := proxyFunc(key)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout: key.dialTimeout,
+			KeepAlive: dial_keep_alive,
+		}).DialContext,
+		ForceAttemptHTTP2: true,
+		MaxIdleConns: key.maxIdleConns,
+		MaxIdleConnsPerHost: key.maxIdleConnsPerHost,
+		MaxConnsPerHost: key.maxConnsPerHost,
+		IdleConnTimeout: idle_conn_timeout,
+		TLSHandshakeTimeout: key.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: key.responseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if transport.TLSClientConfig, err = key.tls.tlsConfig(); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// proxy given explicitly takes precedence over the environment variables
+func proxyFunc(key transportKey) (func(*http.Request) (*url.URL, error), error) {
+	if len(key.proxy) > 0 {
+		u, err := url.Parse(key.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("bad proxy url: %v", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy scheme %s not supported", u.Scheme)
+		}
+		if len(u.Host) == 0 {
+			return nil, fmt.Errorf("no host in proxy url %s", key.proxy)
+		}
+		return http.ProxyURL(u), nil
+	}
+	if key.proxyFromEnv {
+		return http.ProxyFromEnvironment, nil
+	}
+	return nil, nil
+}
+
+// close idle connections of all the shared transports
+func CloseIdleConnections() {
+	transportPool.Lock()
+	defer transportPool.Unlock()
+
+	for _, transport := range transportPool.transports {
+		transport.CloseIdleConnections()
+	}
+}
@@ -1,12 +1,26 @@
 package wget
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"net"
+	"io/ioutil"
 	"strings"
+	"time"
+	"sync/atomic"
+	"encoding/pem"
+	"encoding/xml"
 	"io"
 	"os"
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"sync"
 )
 
 var (
@@ -95,10 +109,1248 @@ func Test_DontReadBody(t *testing.T) {
 
 func Test_httpBuildParmas(t *testing.T) {
 	s := strings.NewReader(`{"a":"b","c":"d"}`)
-	if _, err := buildHttpParams(s); err != nil {
+	if _, err := buildHttpParams(s, NestedDot, nil); err != nil {
 		fmt.Printf("----failed to buildHttpParams: %v\n", err)
 	} else {
 		fmt.Printf("----buildHttpParmas ok\n")
 	}
 }
 
+
+func Test_Retry(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	status, content, _, err := Wget(ts.URL, http.MethodPost, params, headers, Options{Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if status != http.StatusOK || atomic.LoadInt32(&count) != 3 || string(content) != "a=b&c=1" {
+		t.Fatalf("unexpected result: status %d, count %d, content %s\n", status, count, content)
+	}
+}
+
+func Test_RetryNonIdempotent(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			// processed, but the connection is broken before responding
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	retry := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	if _, _, _, err := Wget(ts.URL, http.MethodPost, params, headers, Options{Retry: retry}); err == nil || atomic.LoadInt32(&count) != 1 {
+		t.Fatalf("POST should not be retried after sent: count %d, %v\n", count, err)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	retry.RetryNonIdempotent = true
+	if _, content, _, err := Wget(ts.URL, http.MethodPost, params, headers, Options{Retry: retry}); err != nil || atomic.LoadInt32(&count) != 2 || string(content) != "ok" {
+		t.Fatalf("POST should be retried: count %d, %s, %v\n", count, content, err)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	if _, content, _, err := Wget(ts.URL, http.MethodGet, params, headers, Options{Retry: NewRetryPolicy(3)}); err != nil || atomic.LoadInt32(&count) != 2 || string(content) != "ok" {
+		t.Fatalf("GET should be retried: count %d, %s, %v\n", count, content, err)
+	}
+}
+
+func Test_RetryAfterTooLong(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	status, _, _, err := Wget(ts.URL, http.MethodGet, nil, nil, Options{Retry: &RetryPolicy{MaxAttempts: 3, MaxDelay: time.Second}})
+	if err != nil || status != http.StatusServiceUnavailable || atomic.LoadInt32(&count) != 1 || time.Since(start) > time.Second {
+		t.Fatalf("unexpected result: status %d, count %d, %v\n", status, count, err)
+	}
+}
+
+func Test_ConnReuse(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	for i:=0; i<3; i++ {
+		if _, _, _, err := Wget(ts.URL, http.MethodGet, nil, nil); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	if atomic.LoadInt32(&conns) != 1 {
+		t.Fatalf("1 connection expected, %d connections created\n", conns)
+	}
+	CloseIdleConnections()
+}
+
+func Test_Context(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2*time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, _, err := WgetContext(ctx, ts.URL, http.MethodGet, nil, nil)
+	if err == nil || ctx.Err() == nil {
+		t.Fatalf("request should be cancelled\n")
+	}
+}
+
+func Test_Middleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	auth := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer token")
+			return next(req)
+		}
+	}
+	_, content, _, err := Wget(ts.URL, http.MethodGet, nil, nil, Options{Middlewares: []Middleware{auth}})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if string(content) != "Bearer token" {
+		t.Fatalf("unexpected content: %s\n", content)
+	}
+
+	canned := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusTeapot, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("canned")), Request: req}, nil
+		}
+	}
+	status, content, _, err := NewRequest(0).Use(canned).Run(ts.URL, http.MethodGet, nil, nil)
+	if err != nil || status != http.StatusTeapot || string(content) != "canned" {
+		t.Fatalf("unexpected result: %d, %s, %v\n", status, content, err)
+	}
+}
+
+func Test_Methods(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.RawQuery, body)
+	}))
+	defer ts.Close()
+
+	_, content, _, err := Wget(ts.URL, "options", map[string]string{"a": "b"}, nil)
+	if err != nil || string(content) != "OPTIONS a=b " {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+	_, content, _, err = Wget(ts.URL, "PROPFIND", map[string]string{"a": "b"}, nil)
+	if err != nil || string(content) != "PROPFIND  a=b" {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+	if status, _, _, err := Wget(ts.URL, "CUSTOM", nil, nil); err == nil || status != 0 {
+		t.Fatalf("CUSTOM should not be allowed\n")
+	}
+	RegisterMethod("CUSTOM", ParamsInQuery)
+	defer UnregisterMethod("CUSTOM")
+	_, content, _, err = Wget(ts.URL, "CUSTOM", map[string]string{"a": "b"}, nil)
+	if err != nil || string(content) != "CUSTOM a=b " {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+}
+
+func Test_MultiValueHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, v := range r.Header.Values("Accept") {
+			w.Header().Add("Set-Cookie", v)
+		}
+	}))
+	defer ts.Close()
+
+	_, _, resp, err := WgetHeader(ts.URL, http.MethodGet, nil, http.Header{"Accept": {"a=1", "b=2"}})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if cookies := GetHeaderValues(resp, "Set-Cookie"); len(cookies) != 2 || cookies[0] != "a=1" || cookies[1] != "b=2" {
+		t.Fatalf("unexpected Set-Cookie: %v\n", cookies)
+	}
+}
+
+func Test_CookieJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "tmp", Value: "t1"})
+			return
+		}
+		c, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(c.Value))
+	}))
+	defer ts.Close()
+
+	jar := NewCookieJar()
+	if _, _, _, err := PostJson(ts.URL+"/login", "", params, nil, Options{CookieJar: jar}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	_, content, _, err := Wget(ts.URL+"/me", http.MethodGet, nil, nil, Options{CookieJar: jar})
+	if err != nil || string(content) != "s1" {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+
+	dir, err := ioutil.TempDir("", "go-wget")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"cookies.txt", "cookies.json"} {
+		file := dir + "/" + name
+		if err = jar.Save(file); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		loaded, err := LoadCookieJar(file)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		_, content, _, err = Wget(ts.URL+"/me", http.MethodGet, nil, nil, Options{CookieJar: loaded})
+		if err != nil || string(content) != "s1" {
+			t.Fatalf("unexpected result with %s: %s, %v\n", name, content, err)
+		}
+	}
+}
+
+type testSuffixList struct{}
+
+func (testSuffixList) PublicSuffix(domain string) string {
+	if strings.HasSuffix(domain, ".co.uk") || domain == "co.uk" {
+		return "co.uk"
+	}
+	return domain[strings.LastIndexByte(domain, '.')+1:]
+}
+
+func (testSuffixList) String() string {
+	return "test"
+}
+
+func Test_CookieJarPublicSuffix(t *testing.T) {
+	u, _ := url.Parse("http://a.co.uk/")
+	cookies := []*http.Cookie{
+		{Name: "suffix", Value: "1", Domain: "co.uk"},
+		{Name: "site", Value: "2", Domain: "a.co.uk"},
+	}
+
+	jar := NewCookieJar(testSuffixList{})
+	jar.SetCookies(u, cookies)
+	other, _ := url.Parse("http://b.co.uk/")
+	if c := jar.Cookies(other); len(c) != 0 {
+		t.Fatalf("cookie of public suffix should be rejected: %v\n", c)
+	}
+	if c := jar.Cookies(u); len(c) != 1 || c[0].Name != "site" {
+		t.Fatalf("unexpected cookies: %v\n", c)
+	}
+
+	// host-only cookie if the host is a public suffix itself
+	ps, _ := url.Parse("http://co.uk/")
+	jar.SetCookies(ps, cookies[:1])
+	if c := jar.Cookies(ps); len(c) != 1 || len(jar.Cookies(other)) != 0 {
+		t.Fatalf("unexpected cookies: %v\n", c)
+	}
+}
+
+func Test_Proxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s %s", r.URL.String(), r.Header.Get("Proxy-Authorization"))
+	}))
+	defer proxy.Close()
+
+	proxyUrl := strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)
+	_, content, _, err := Wget("http://example.com/get", http.MethodGet, nil, nil, Options{Proxy: proxyUrl})
+	if err != nil || string(content) != "proxied http://example.com/get Basic dXNlcjpwYXNz" {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+	if _, _, _, err = Wget("http://example.com/get", http.MethodGet, nil, nil, Options{Proxy: "ftp://127.0.0.1"}); err == nil {
+		t.Fatalf("error expected for unsupported proxy\n")
+	}
+}
+
+func Test_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	if _, _, _, err := Wget(ts.URL, http.MethodGet, nil, nil); err == nil {
+		t.Fatalf("unknown certificate should not be accepted by default\n")
+	}
+	if _, content, _, err := Wget(ts.URL, http.MethodGet, nil, nil, Options{TLS: &TLSOptions{InsecureSkipVerify: true}}); err != nil || string(content) != "ok" {
+		t.Fatalf("unexpected result in insecure mode: %s, %v\n", content, err)
+	}
+
+	caFile, err := ioutil.TempFile("", "go-wget-ca")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	caFile.Close()
+	if _, content, _, err := Wget(ts.URL, http.MethodGet, nil, nil, Options{TLS: &TLSOptions{CAFile: caFile.Name()}}); err != nil || string(content) != "ok" {
+		t.Fatalf("unexpected result with CA file: %s, %v\n", content, err)
+	}
+}
+
+func Test_IdleReadTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pause := 30*time.Millisecond
+		if r.URL.Path == "/stuck" {
+			pause = time.Second
+		}
+		for i:=0; i<5; i++ {
+			w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(pause):
+			}
+		}
+	}))
+	defer ts.Close()
+
+	timeouts := &Timeouts{IdleRead: 200*time.Millisecond, Overall: 10*time.Second}
+	_, content, _, err := Wget(ts.URL+"/slow", http.MethodGet, nil, nil, Options{Timeouts: timeouts})
+	if err != nil || len(content) != 20 {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+
+	fp := Get(ts.URL+"/stuck", &Args{Timeouts: timeouts})
+	defer fp.Close()
+	start := time.Now()
+	if _, err = ioutil.ReadAll(fp); err == nil {
+		t.Fatalf("idle timeout expected\n")
+	}
+	if time.Since(start) > 800*time.Millisecond {
+		t.Fatalf("idle timeout took too long\n")
+	}
+}
+
+func Test_MaxBodyBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"a":"` + strings.Repeat("x", 100) + `"}`
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte(body[:50]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[50:]))
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/", "/chunked"} {
+		if _, _, _, err := Wget(ts.URL+path, http.MethodGet, nil, nil, Options{MaxBodyBytes: 10}); err != ErrBodyTooLarge {
+			t.Fatalf("ErrBodyTooLarge expected for %s, got %v\n", path, err)
+		}
+		var res map[string]interface{}
+		if _, err := HttpCallJ(ts.URL+path, http.MethodGet, nil, nil, &res, Options{MaxBodyBytes: 10}); err != ErrBodyTooLarge {
+			t.Fatalf("ErrBodyTooLarge expected for %s, got %v\n", path, err)
+		}
+		fp := Get(ts.URL+path, &Args{MaxBodyBytes: 10})
+		if _, err := ioutil.ReadAll(fp); err != ErrBodyTooLarge {
+			t.Fatalf("ErrBodyTooLarge expected for %s, got %v\n", path, err)
+		}
+		fp.Close()
+	}
+	if _, content, _, err := Wget(ts.URL+"/chunked", http.MethodGet, nil, nil, Options{MaxBodyBytes: 108}); err != nil || len(content) != 108 {
+		t.Fatalf("unexpected result: %d, %v\n", len(content), err)
+	}
+}
+
+func Test_Multipart(t *testing.T) {
+	count := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1<<20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if count++; count == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		content, _ := ioutil.ReadAll(f)
+		fmt.Fprintf(w, "%s %s %s %s %s", r.FormValue("a"), fh.Filename, fh.Header.Get("Content-Type"), content, r.FormValue("b"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "go-wget")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/b.txt", []byte("file b"), 0644)
+
+	m := NewMultipart().AddField("a", "1").AddReader("file", "a.json", strings.NewReader(`{"a":1}`)).AddFile("b", dir+"/b.txt")
+	status, content, _, err := Wget(ts.URL, http.MethodPost, m, nil, Options{Retry: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}})
+	if err != nil || status != http.StatusOK || string(content) != `1 a.json application/json {"a":1} ` {
+		t.Fatalf("unexpected result: %d, %s, %v\n", status, content, err)
+	}
+
+	count = 1
+	m = NewMultipart().AddField("a", "2").AddFile("file", dir+"/b.txt", "text/plain")
+	fp := Post(ts.URL, &Args{Params: m})
+	defer fp.Close()
+	content, _ = ioutil.ReadAll(fp)
+	if string(content) != "2 b.txt text/plain file b " {
+		t.Fatalf("unexpected result: %s\n", content)
+	}
+}
+
+func Test_MultipartEarlyResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer ts.Close()
+
+	m := NewMultipart().AddReader("file", "big.bin", bytes.NewReader(make([]byte, 8<<20)))
+	status, _, _, err := Wget(ts.URL, http.MethodPost, m, nil)
+	if err != nil || status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected result: %d, %v\n", status, err)
+	}
+	select {
+	case <-m.done:
+	case <-time.After(2*time.Second):
+		t.Fatalf("multipart writer should exit after the request is done\n")
+	}
+}
+
+func Test_FormEncoding(t *testing.T) {
+	type Addr struct {
+		City string `form:"city"`
+		Zip  string `form:"zip,omitempty"`
+	}
+	type Base struct {
+		Id int `form:"id"`
+	}
+	type Query struct {
+		Base
+		Name    string    `form:"name"`
+		Tags    []string  `form:"tags"`
+		Addr    Addr      `form:"addr"`
+		Born    time.Time `form:"born" time_format:"2006-01-02"`
+		Ignored string    `form:"-"`
+		Empty   string    `form:"empty,omitempty"`
+	}
+	q := &Query{Base: Base{1}, Name: "n", Tags: []string{"a", "b"}, Addr: Addr{City: "c"}, Born: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), Ignored: "x"}
+
+	cases := []struct{
+		style NestedStyle
+		expected string
+	}{
+		{NestedDot, "addr.city=c&born=2000-01-02&id=1&name=n&tags=a&tags=b"},
+		{NestedBracket, "addr%5Bcity%5D=c&born=2000-01-02&id=1&name=n&tags=a&tags=b"},
+		{NestedPHP, "addr%5Bcity%5D=c&born=2000-01-02&id=1&name=n&tags%5B%5D=a&tags%5B%5D=b"},
+	}
+	for _, c := range cases {
+		p, err := buildHttpStringParams(q, c.style)
+		if err != nil || p != c.expected {
+			t.Fatalf("unexpected params with style %d: %s, %v\n", c.style, p, err)
+		}
+	}
+
+	p, err := buildHttpStringParams(map[string]interface{}{"a": []int{1, 2}, "b": map[string]interface{}{"c": "d"}}, NestedDot)
+	if err != nil || p != "a=1&a=2&b.c=d" {
+		t.Fatalf("unexpected params: %s, %v\n", p, err)
+	}
+
+	// values are formatted like "%v" as before
+	p, err = buildHttpStringParams(map[string]interface{}{"d": 90*time.Second, "amount": testMoney{1234}, "n": nil}, NestedDot)
+	if err != nil || p != "amount=12.34&d=1m30s&n=%3Cnil%3E" {
+		t.Fatalf("unexpected params: %s, %v\n", p, err)
+	}
+	if p, err = buildHttpStringParams(map[string]interface{}{"a": struct{ a int }{1}}, NestedDot); err == nil {
+		t.Fatalf("struct without exported fields should not be encoded: %s\n", p)
+	}
+}
+
+type testMoney struct {
+	cents int
+}
+
+func (m testMoney) String() string {
+	return fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100)
+}
+
+func Test_OrderedParams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s|%s", r.URL.RawQuery, body)
+	}))
+	defer ts.Close()
+
+	sign := func(encoded string) (string, error) {
+		return fmt.Sprintf("%s&sign=%d", encoded, len(encoded)), nil
+	}
+	p := NewOrderedParams().Add("z", 1).Add("a", "b c").Add("m", []string{"1", "2"})
+	_, content, _, err := Wget(ts.URL+"?x=y", http.MethodGet, p, nil, Options{ParamsHook: sign})
+	if err != nil || string(content) != "x=y&z=1&a=b+c&m=1&m=2&sign=17|" {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+	_, content, _, err = Wget(ts.URL, http.MethodPost, p, nil, Options{ParamsHook: sign})
+	if err != nil || string(content) != "|z=1&a=b+c&m=1&m=2&sign=17" {
+		t.Fatalf("unexpected result: %s, %v\n", content, err)
+	}
+}
+
+func Test_Xml(t *testing.T) {
+	type Order struct {
+		XMLName xml.Name `xml:"xml"`
+		Id      string   `xml:"id"`
+		Amount  int      `xml:"amount"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var o Order
+		if err := xml.NewDecoder(r.Body).Decode(&o); err != nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/xml") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		o.Amount *= 2
+		xml.NewEncoder(w).Encode(&o)
+	}))
+	defer ts.Close()
+
+	var res Order
+	status, err := XmlCallX(ts.URL, "", &Order{Id: "1", Amount: 100}, nil, &res)
+	if err != nil || status != http.StatusOK || res.Id != "1" || res.Amount != 200 {
+		t.Fatalf("unexpected result: %d, %#v, %v\n", status, res, err)
+	}
+
+	res = Order{}
+	status, err = FsCallAndParseXML(ts.URL, http.MethodPost, &res, &Args{Params: `<xml><id>2</id><amount>1</amount></xml>`, XmlCall: true})
+	if err != nil || status != http.StatusOK || res.Id != "2" || res.Amount != 2 {
+		t.Fatalf("unexpected result: %d, %#v, %v\n", status, res, err)
+	}
+
+	res = Order{}
+	status, err = XmlCallX(ts.URL, "", map[string]interface{}{"id": "3<&>", "amount": 5}, nil, &res)
+	if err != nil || status != http.StatusOK || res.Id != "3<&>" || res.Amount != 10 {
+		t.Fatalf("unexpected result: %d, %#v, %v\n", status, res, err)
+	}
+	b, err := XmlCodec.Marshal(map[string]string{"b": "2", "a": "x&y"})
+	if err != nil || string(b) != "<xml><a>x&amp;y</a><b>2</b></xml>" {
+		t.Fatalf("unexpected xml: %s, %v\n", b, err)
+	}
+}
+
+func Test_Codec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Write([]byte(r.Header.Get("Content-Type") + "|" + string(body)))
+	}))
+	defer ts.Close()
+
+	upper := &CodecFuncs{
+		Type: "text/x-upper",
+		MarshalFunc: func(v interface{}) ([]byte, error) {
+			return []byte(strings.ToUpper(fmt.Sprintf("%v", v))), nil
+		},
+		UnmarshalFunc: func(data []byte, v interface{}) error {
+			*(v.(*string)) = strings.ToLower(string(data))
+			return nil
+		},
+	}
+	RegisterCodec(upper)
+	defer UnregisterCodec(upper.ContentType())
+
+	var out string
+	_, err := Call(ts.URL+"?type=text/x-upper", http.MethodPost, upper, "abc", &out)
+	if err != nil || out != "text/x-upper|abc" {
+		t.Fatalf("unexpected result: %s, %v\n", out, err)
+	}
+
+	var form url.Values
+	_, err = Call(ts.URL+"?type=application/x-www-form-urlencoded", http.MethodPost, FormCodec, map[string]string{"a": "b"}, &form)
+	if err != nil || form.Get("application/x-www-form-urlencoded|a") != "b" {
+		t.Fatalf("unexpected result: %v, %v\n", form, err)
+	}
+}
+
+func Test_HTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":1001,"msg":"bad name"}`))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("<html>" + strings.Repeat("x", 2*max_error_body_bytes) + "</html>"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"code":0}`))
+		}
+	}))
+	defer ts.Close()
+
+	type apiError struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+
+	var res apiError
+	var errRes apiError
+	status, err := HttpCallJ(ts.URL+"/json", "GET", nil, nil, &res, Options{ErrorOnNon2xx: true, ErrorResult: &errRes})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || status != http.StatusBadRequest || httpErr.Status != status {
+		t.Fatalf("HTTPError expected, got %d %v\n", status, err)
+	}
+	if httpErr.ErrorResult != &errRes || errRes.Code != 1001 || res.Code != 0 {
+		t.Fatalf("error body not decoded: %v\n", errRes)
+	}
+
+	_, err = JsonCallJ(ts.URL+"/html", "POST", map[string]int{"a": 1}, nil, &res, Options{ErrorOnNon2xx: true, ErrorResult: &errRes})
+	if !errors.As(err, &httpErr) || len(httpErr.Body) != max_error_body_bytes || httpErr.ErrorResult != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+
+	_, err = FsCallAndParseJSON(ts.URL+"/ok", "GET", &res, &Args{ExpectStatus: []int{http.StatusOK}})
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusAccepted {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if _, err = FsCallAndParseJSON(ts.URL+"/ok", "GET", &res, &Args{ErrorOnNon2xx: true}); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+}
+
+func Test_ErrorClassifiers(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	refused := "http://" + ln.Addr().String()
+	ln.Close()
+
+	status, _, _, err := Wget(refused, "GET", nil, nil)
+	if status != 0 || !IsConnRefused(err) || !IsRetryable(err) || IsTimeout(err) {
+		t.Fatalf("connection refused expected, got %d %v\n", status, err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	status, _, _, err = Wget(ts.URL+"/slow", "GET", nil, nil, Options{Timeouts: &Timeouts{ResponseHeader: 50 * time.Millisecond}})
+	if status != 0 || !IsTimeout(err) || !IsRetryable(err) {
+		t.Fatalf("timeout expected, got %d %v\n", status, err)
+	}
+	if status, _, _, err = Wget(ts.URL, "GET", nil, nil); status != http.StatusInternalServerError || err != nil {
+		t.Fatalf("real status expected, got %d %v\n", status, err)
+	}
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	status, _, _, err = Wget(tlsServer.URL, "GET", nil, nil)
+	if status != 0 || !IsTLSError(err) || IsRetryable(err) {
+		t.Fatalf("TLS error expected, got %d %v\n", status, err)
+	}
+	if err = fmt.Errorf("proxy: tls: bad upstream"); IsTLSError(err) {
+		t.Fatalf("untyped error should not be a TLS error: %v\n", err)
+	}
+
+	if _, _, _, err = Wget("http://no-such-host.invalid", "GET", nil, nil); !IsDNSError(err) {
+		t.Fatalf("DNS error expected, got %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err = WgetContext(ctx, ts.URL, "GET", nil, nil); err == nil || IsRetryable(err) {
+		t.Fatalf("cancelled request is not retryable: %v\n", err)
+	}
+
+	// fail over from the refused item
+	multiBase, err := NewBaseUrl(BaseItem(refused, 1), BaseItem(ts.URL, 1))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 4; i++ {
+		if status, _, _, err = multiBase.HttpCall("/", "GET", nil, nil); status != http.StatusInternalServerError || err != nil {
+			t.Fatalf("failover expected, got %d %v\n", status, err)
+		}
+	}
+
+	// fail over from the item with a bad certificate, though it is not retryable
+	if multiBase, err = NewBaseUrl(BaseItem(tlsServer.URL, 1), BaseItem(ts.URL, 1)); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 4; i++ {
+		if status, _, _, err = multiBase.HttpCall("/", "GET", nil, nil); status != http.StatusInternalServerError || err != nil {
+			t.Fatalf("failover expected, got %d %v\n", status, err)
+		}
+	}
+	if _, _, _, err = multiBase.HttpCall("/", "NO-SUCH-METHOD", nil, nil); err == nil || shouldFailover(err) {
+		t.Fatalf("invalid request should not fail over: %v\n", err)
+	}
+}
+
+func Test_Do(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<user><name>x</name><age>3</age></user>`))
+		case "/text":
+			w.Write([]byte("hello"))
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		}
+	}))
+	defer ts.Close()
+
+	type user struct {
+		Name string `json:"name" xml:"name"`
+		Age  int    `json:"age" xml:"age"`
+	}
+
+	u, resp, err := Do[user](ts.URL+"/json", "POST", user{Name: "y", Age: 5})
+	if err != nil || resp.Status != http.StatusOK || u.Name != "y" || u.Age != 5 {
+		t.Fatalf("unexpected result: %v, %v\n", u, err)
+	}
+	pu, _, err := Do[*user](ts.URL+"/xml", "GET", nil)
+	if err != nil || pu == nil || pu.Name != "x" || pu.Age != 3 {
+		t.Fatalf("unexpected result: %v, %v\n", pu, err)
+	}
+	text, _, err := Do[string](ts.URL+"/text", "GET", nil)
+	if err != nil || text != "hello" {
+		t.Fatalf("unexpected result: %s, %v\n", text, err)
+	}
+
+	multiBase, err := NewBaseUrl(BaseItem(ts.URL))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	u, resp, err = DoBase[user](multiBase, "/xml", "GET", nil)
+	if err != nil || resp.Header.Get("Content-Type") != "application/xml" || u.Name != "x" {
+		t.Fatalf("unexpected result: %v, %v\n", u, err)
+	}
+}
+
+func Test_Download(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10000))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var requests int32
+	var ranges []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+		mu.Unlock()
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// broken after half of the content is sent
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "f", modTime, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "f.bin")
+	var lastDone, lastTotal int64
+	err := Download(ts.URL, dest, &DownloadArgs{
+		Args: Args{Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}},
+		Progress: func(done, total int64, rate float64) {
+			lastDone, lastTotal = done, total
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	b, _ := ioutil.ReadFile(dest)
+	if !bytes.Equal(b, content) {
+		t.Fatalf("bad content of %d bytes\n", len(b))
+	}
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-|\"v1\"", len(content)/2) {
+		t.Fatalf("unexpected requests: %v\n", ranges)
+	}
+	if lastDone != int64(len(content)) || lastTotal != lastDone {
+		t.Fatalf("unexpected progress: %d/%d\n", lastDone, lastTotal)
+	}
+	if fi, err := os.Stat(dest); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Fatalf("unexpected mtime: %v\n", err)
+	}
+	if _, err := os.Stat(dest + part_suffix); !os.IsNotExist(err) {
+		t.Fatalf("partial file is not removed\n")
+	}
+	if _, err := os.Stat(dest + meta_suffix); !os.IsNotExist(err) {
+		t.Fatalf("meta file is not removed\n")
+	}
+}
+
+func Test_DownloadRangeNotSatisfiable(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "go-wget")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "a.bin")
+	ioutil.WriteFile(dest+part_suffix, []byte("01234"), 0644)
+
+	// retried once without Range
+	err = Download(ts.URL, dest)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusRequestedRangeNotSatisfiable || atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("unexpected result: %d requests, %v\n", requests, err)
+	}
+}
+
+func Test_DownloadParallel(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 4000))
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	var failed int32
+	newServer := func(noRanges bool, ranges *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.Header.Get("Range")) > 0 {
+				atomic.AddInt32(ranges, 1)
+				if atomic.CompareAndSwapInt32(&failed, 0, 1) {
+					// the first chunk request fails
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			if noRanges {
+				w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+				w.Write(content)
+				return
+			}
+			http.ServeContent(w, r, "f", modTime, bytes.NewReader(content))
+		}))
+	}
+	var ranges1, ranges2 int32
+	ts1, ts2 := newServer(false, &ranges1), newServer(false, &ranges2)
+	defer ts1.Close()
+	defer ts2.Close()
+
+	multiBase, err := NewBaseUrl(BaseItem(ts1.URL), BaseItem(ts2.URL))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "f.bin")
+	var lastDone int64
+	err = DownloadParallel("/f.bin", dest, &ParallelArgs{
+		DownloadArgs: DownloadArgs{
+			Args: Args{Retry: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}},
+			Progress: func(done, total int64, rate float64) { lastDone = done },
+		},
+		Chunks: 4,
+		MinChunkSize: 1000,
+		MultiBase: multiBase,
+	})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	b, _ := ioutil.ReadFile(dest)
+	if !bytes.Equal(b, content) || lastDone != int64(len(content)) {
+		t.Fatalf("bad content of %d bytes, progress %d\n", len(b), lastDone)
+	}
+	if ranges1 == 0 || ranges2 == 0 || ranges1+ranges2 != 5 {
+		t.Fatalf("chunks not spread: %d, %d\n", ranges1, ranges2)
+	}
+	if fi, err := os.Stat(dest); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Fatalf("unexpected mtime: %v\n", err)
+	}
+
+	// single stream without Accept-Ranges
+	var ranges3 int32
+	ts3 := newServer(true, &ranges3)
+	defer ts3.Close()
+	dest = filepath.Join(dir, "g.bin")
+	if err = DownloadParallel(ts3.URL, dest, &ParallelArgs{MinChunkSize: 1000}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if b, _ = ioutil.ReadFile(dest); !bytes.Equal(b, content) || ranges3 != 0 {
+		t.Fatalf("bad content of %d bytes, %d range requests\n", len(b), ranges3)
+	}
+
+	// the first mirror fails, the single stream goes to the mirror answered
+	var badGets int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			atomic.AddInt32(&badGets, 1)
+		}
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer bad.Close()
+	multiBase, err = NewBaseUrl(BaseItem(bad.URL), BaseItem(ts3.URL))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	dest = filepath.Join(dir, "h.bin")
+	if err = DownloadParallel("/h.bin", dest, &ParallelArgs{MinChunkSize: 1000, MultiBase: multiBase}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if b, _ = ioutil.ReadFile(dest); !bytes.Equal(b, content) || atomic.LoadInt32(&badGets) != 0 {
+		t.Fatalf("bad content of %d bytes, %d requests to the failed mirror\n", len(b), badGets)
+	}
+
+	// a non-2xx HEAD is an *HTTPError
+	multiBase, _ = NewBaseUrl(BaseItem(bad.URL))
+	err = DownloadParallel("/i.bin", filepath.Join(dir, "i.bin"), &ParallelArgs{MultiBase: multiBase})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusNotFound {
+		t.Fatalf("*HTTPError expected, got %v\n", err)
+	}
+}
+
+func Test_Mirror(t *testing.T) {
+	pages := map[string]string{
+		"/docs/":          `<html><link href="style.css" rel="stylesheet"><a href="a.html#top">a</a> <a href='/docs/sub/b'>b</a> <a href="/other/">other</a> <a href="http://external.invalid/x">x</a><img srcset="img/x.png 1x, img/y.png 2x"></html>`,
+		"/docs/style.css": `body { background: url("img/bg.png") }`,
+		"/docs/a.html":    `<a href="/docs/">home</a>`,
+		"/docs/sub/b":     `<a href="c.html">c</a>`,
+		"/docs/sub/c.html": `<a href="d.html">too deep</a>`,
+	}
+	var requested []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if page, ok := pages[r.URL.Path]; ok {
+			if strings.HasSuffix(r.URL.Path, ".css") {
+				w.Header().Set("Content-Type", "text/css")
+			} else {
+				w.Header().Set("Content-Type", "text/html")
+			}
+			w.Write([]byte(page))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/docs/img/") {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	err := Mirror(ts.URL+"/docs/", dir, &MirrorArgs{MaxDepth: 2, PathPrefix: "/docs/", ConvertLinks: true})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	u, _ := url.Parse(ts.URL)
+	root := filepath.Join(dir, u.Hostname()+"_"+u.Port())
+	for _, name := range []string{"docs/index.html", "docs/style.css", "docs/a.html", "docs/sub/b.html", "docs/sub/c.html", "docs/img/x.png", "docs/img/y.png", "docs/img/bg.png"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Fatalf("%s not saved: %v, requested: %v\n", name, err, requested)
+		}
+	}
+	for _, p := range requested {
+		if p == "/other/" || p == "/docs/sub/d.html" {
+			t.Fatalf("%s should not be followed\n", p)
+		}
+	}
+
+	index, _ := ioutil.ReadFile(filepath.Join(root, "docs/index.html"))
+	for _, s := range []string{`href="a.html#top"`, `href='sub/b.html'`, `href="` + ts.URL + `/other/"`, `srcset="img/x.png 1x, img/y.png 2x"`} {
+		if !strings.Contains(string(index), s) {
+			t.Fatalf("%s not found in converted index: %s\n", s, index)
+		}
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(root, "docs/sub/b.html"))
+	if !strings.Contains(string(b), `href="c.html"`) {
+		t.Fatalf("unexpected converted page: %s\n", b)
+	}
+	a, _ := ioutil.ReadFile(filepath.Join(root, "docs/a.html"))
+	if !strings.Contains(string(a), `href="index.html"`) {
+		t.Fatalf("unexpected converted page: %s\n", a)
+	}
+
+	for rawurl, expected := range map[string]string{
+		"http://a.com/x":      "a.com",
+		"http://a.com:80/x":   "a.com",
+		"https://a.com:443/x": "a.com",
+		"http://a.com:443/x":  "a.com_443",
+		"http://[::1]:8080/x": "__1_8080",
+	} {
+		u, _ := url.Parse(rawurl)
+		if d := hostDir(u); d != expected {
+			t.Fatalf("%s expected for %s, got %s\n", expected, rawurl, d)
+		}
+	}
+}
+
+func Test_MirrorRedirect(t *testing.T) {
+	var requested []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/docs/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="moved">moved</a>`))
+		case "/docs/moved":
+			http.Redirect(w, r, "/other/", http.StatusFound)
+		case "/other/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="secret">secret</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := Mirror(ts.URL+"/docs/", dir, &MirrorArgs{PathPrefix: "/docs/"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	u, _ := url.Parse(ts.URL)
+	if _, err := os.Stat(filepath.Join(dir, u.Hostname()+"_"+u.Port(), "other")); !os.IsNotExist(err) {
+		t.Fatalf("page redirected out of the limits should not be saved\n")
+	}
+	for _, p := range requested {
+		if p == "/other/secret" {
+			t.Fatalf("links of the page redirected out of the limits should not be followed\n")
+		}
+	}
+}
+
+func Test_Cache(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/large", "/slow":
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprintf(w, "%s %d", r.URL.Path, n)
+			// sent in chunks without Content-Length
+			w.(http.Flusher).Flush()
+			if r.URL.Path == "/slow" {
+				time.Sleep(300*time.Millisecond)
+			}
+			w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		}
+		fmt.Fprintf(w, "%s %d", r.URL.Path, n)
+	}))
+	defer ts.Close()
+
+	diskCache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for _, cache := range []Cache{NewMemoryCache(), diskCache} {
+		get := func(path string, expected string) string {
+			_, content, resp, err := Wget(ts.URL+path, "GET", nil, nil, Options{Cache: cache})
+			if err != nil {
+				t.Fatalf("%v\n", err)
+			}
+			if status := GetCacheStatus(resp); status != expected {
+				t.Fatalf("%s: cache status %q expected, got %q\n", path, expected, status)
+			}
+			return string(content)
+		}
+
+		atomic.StoreInt32(&hits, 0)
+		first := get("/fresh", CacheMiss)
+		if second := get("/fresh", CacheHit); second != first || atomic.LoadInt32(&hits) != 1 {
+			t.Fatalf("cached body %q expected, got %q\n", first, second)
+		}
+
+		first = get("/etag", CacheMiss)
+		if second := get("/etag", CacheRevalidated); second != first || atomic.LoadInt32(&hits) != 3 {
+			t.Fatalf("revalidated body %q expected, got %q\n", first, second)
+		}
+
+		get("/no-store", CacheMiss)
+		get("/no-store", CacheMiss)
+
+		// not invalidated by safe methods
+		Wget(ts.URL+"/fresh", "OPTIONS", nil, nil, Options{Cache: cache})
+		get("/fresh", CacheHit)
+
+		// invalidated by POST
+		Wget(ts.URL+"/fresh", "POST", nil, nil, Options{Cache: cache})
+		get("/fresh", CacheMiss)
+
+		// stored per credentials
+		getWith := func(header map[string]string, expected string) {
+			_, _, resp, err := Wget(ts.URL+"/fresh", "GET", nil, header, Options{Cache: cache})
+			if err != nil || GetCacheStatus(resp) != expected {
+				t.Fatalf("%v: cache status %q expected, got %q, %v\n", header, expected, GetCacheStatus(resp), err)
+			}
+		}
+		getWith(map[string]string{"Authorization": "Bearer a"}, CacheMiss)
+		getWith(map[string]string{"Authorization": "Bearer a"}, CacheHit)
+		getWith(map[string]string{"Authorization": "Bearer b"}, CacheMiss)
+		getWith(map[string]string{"Cookie": "session=a"}, CacheMiss)
+		getWith(nil, CacheHit)
+
+		// Content-Length of HEAD is kept
+		var headLength int64 = -1
+		for _, expected := range []string{CacheMiss, CacheHit} {
+			_, _, resp, err := Wget(ts.URL+"/fresh", "HEAD", nil, nil, Options{Cache: cache})
+			if err != nil || GetCacheStatus(resp) != expected || resp.ContentLength <= 0 || (headLength >= 0 && resp.ContentLength != headLength) {
+				t.Fatalf("HEAD: cache status %q expected, got %q, length %d, %v\n", expected, GetCacheStatus(resp), resp.ContentLength, err)
+			}
+			headLength = resp.ContentLength
+		}
+
+		// larger than MaxBodyBytes, not stored
+		if _, _, _, err := Wget(ts.URL+"/large", "GET", nil, nil, Options{Cache: cache, MaxBodyBytes: 50}); err != ErrBodyTooLarge {
+			t.Fatalf("ErrBodyTooLarge expected, got %v\n", err)
+		}
+		get("/large", CacheMiss)
+		get("/large", CacheHit)
+	}
+
+	// buffering the body for the cache is limited by Timeouts.IdleRead
+	options := Options{Cache: NewMemoryCache(), Timeouts: &Timeouts{IdleRead: 100*time.Millisecond}}
+	if _, _, _, err := Wget(ts.URL+"/slow", "GET", nil, nil, options); !IsTimeout(err) {
+		t.Fatalf("timeout expected, got %v\n", err)
+	}
+
+	if _, _, resp, _ := Wget(ts.URL+"/fresh", "GET", nil, nil); GetCacheStatus(resp) != "" {
+		t.Fatalf("no cache status expected without cache\n")
+	}
+}
+
+func Test_RateLimit(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 && r.URL.Path == "/adaptive" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+		}
+		w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	// per host
+	SetHostRateLimiter(u.Host, NewRateLimiter(50, 1))
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, _, _, err := Wget(ts.URL, "GET", nil, nil); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 70*time.Millisecond {
+		t.Fatalf("requests not limited: %v\n", elapsed)
+	}
+	if status, _, _, err := Wget(ts.URL, "GET", nil, nil, Options{RateLimitNoWait: true}); status != 0 || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("ErrRateLimited expected, got %d %v\n", status, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	SetHostRateLimiter(u.Host, NewRateLimiter(0.1, 1))
+	Wget(ts.URL, "GET", nil, nil)
+	if _, _, _, err := WgetContext(ctx, ts.URL, "GET", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("deadline exceeded expected, got %v\n", err)
+	}
+	SetHostRateLimiter(u.Host, nil)
+
+	// adaptive
+	atomic.StoreInt32(&hits, 0)
+	limiter := NewRateLimiter(1000, 10)
+	limiter.Adaptive = true
+	SetGlobalRateLimiter(limiter)
+	Wget(ts.URL+"/adaptive", "GET", nil, nil)
+	started = time.Now()
+	Wget(ts.URL+"/adaptive", "GET", nil, nil)
+	SetGlobalRateLimiter(nil)
+	if elapsed := time.Since(started); elapsed < 500*time.Millisecond {
+		t.Fatalf("X-RateLimit-Reset not honored: %v\n", elapsed)
+	}
+
+	// per BaseUrl item, failed over without waiting
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ts2"))
+	}))
+	defer ts2.Close()
+	multiBase, err := NewBaseUrl(BaseItem(ts.URL), BaseItem(ts2.URL))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	exhausted := NewRateLimiter(0.001, 1)
+	exhausted.Allow()
+	if err = multiBase.SetRateLimiter(ts.URL, exhausted); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 4; i++ {
+		_, content, _, err := multiBase.HttpCall("/", "GET", nil, nil, Options{RateLimitNoWait: true})
+		if err != nil || string(content) != "ts2" {
+			t.Fatalf("failover expected, got %s %v\n", content, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package wget
+
+import (
+	"context"
+)
+
+// same as HttpCallJ, but the response body is decoded as XML
+func HttpCallX(url string, method string, postData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(context.Background(), url, method, postData, headers, WgetContext, XmlCodec, res, options...)
+}
+
+// post params as XML, and decode the response body as XML
+func XmlCallX(url string, method string, xmlData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(context.Background(), url, method, xmlData, headers, PostXmlContext, XmlCodec, res, options...)
+}
+
+func HttpCallXContext(ctx context.Context, url string, method string, postData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(ctx, url, method, postData, headers, WgetContext, XmlCodec, res, options...)
+}
+
+func XmlCallXContext(ctx context.Context, url string, method string, xmlData interface{}, headers map[string]string, res interface{}, options ...Options) (int, error) {
+	return callWgetJ(ctx, url, method, xmlData, headers, PostXmlContext, XmlCodec, res, options...)
+}